@@ -7,10 +7,12 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -43,18 +45,27 @@ func (t *Tracer) RoundTrip(req *http.Request) (*http.Response, error) {
 		return resp, err
 	}
 
+	// Watch responses are endless streams: dump only
+	// the headers and then trace each event as it flows.
+	watching := req.URL.Query().Get("watch") == "true"
+
 	// Dump the response to os.Stderr.
-	b, err = httputil.DumpResponse(resp, req.URL.Query().Get("watch") != "true")
+	b, err = httputil.DumpResponse(resp, !watching)
 	if err != nil {
 		return nil, err
 	}
 	os.Stderr.Write(b)
 	os.Stderr.Write([]byte{'\n'})
 
+	if watching && isJSON(resp.Header.Get("Content-Type")) {
+		resp.Body = newWatchBodyTracer(resp.Body)
+	}
+
 	return resp, err
 }
 
 // go run main.go -namespace kube-system
+// go run main.go -namespace kube-system -verbose -watch 30s
 func main() {
 	defaultKubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
 	if len(defaultKubeconfig) == 0 {
@@ -69,6 +80,8 @@ func main() {
 
 	verbose := flag.Bool("verbose", false, "display HTTP calls")
 
+	watchFor := flag.Duration("watch", 0, "watch pods for this amount of time instead of listing them")
+
 	flag.Parse()
 
 	rc, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
@@ -95,6 +108,11 @@ func main() {
 		Resource: "pods",
 	}
 
+	if *watchFor > 0 {
+		watchPods(dc, gvr, *namespace, *watchFor)
+		return
+	}
+
 	// list all pods in the specified namespace
 	res, err := dc.Resource(gvr).
 		Namespace(*namespace).
@@ -110,3 +128,36 @@ func main() {
 		fmt.Printf("%v\n", el.GetName())
 	}
 }
+
+// watchPods watches pods in the specified namespace for the given amount of time
+// and prints the name of the pod of each received event
+func watchPods(dc dynamic.Interface, gvr schema.GroupVersionResource, namespace string, d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	watcher, err := dc.Resource(gvr).
+		Namespace(namespace).
+		Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if event.Type == watch.Error {
+				fmt.Printf("%v\n", errors.FromObject(event.Object))
+				continue
+			}
+			if obj, ok := event.Object.(metav1.Object); ok {
+				fmt.Printf("%s %v\n", event.Type, obj.GetName())
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// watchFrame holds the bits of a watch event we want to print.
+//
+// The API server streams watch events as a sequence of JSON
+// documents like `{"type":"ADDED","object":{...}}`, one per line.
+type watchFrame struct {
+	Type   string `json:"type"`
+	Object struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name            string `json:"name"`
+			Namespace       string `json:"namespace"`
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	} `json:"object"`
+}
+
+// watchBodyTracer wraps the body of a watch response.  Every chunk read by
+// the decoder is copied in a small buffer; each time a full frame is
+// available a one-line summary is printed to os.Stderr.  Only the current
+// (incomplete) frame is kept in memory, never the whole stream.
+type watchBodyTracer struct {
+	io.ReadCloser
+	buf bytes.Buffer
+}
+
+// newWatchBodyTracer returns the given response body wrapped
+// by a reader that prints each watch event frame as it streams.
+func newWatchBodyTracer(body io.ReadCloser) io.ReadCloser {
+	return &watchBodyTracer{ReadCloser: body}
+}
+
+// Read reads from the nested body, then prints any complete frame.  The
+// bytes are handed over untouched, so the consuming decoder is unaffected.
+func (t *watchBodyTracer) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.buf.Write(p[:n])
+		t.flush()
+	}
+	return n, err
+}
+
+// flush prints all the complete frames found in the buffer.
+func (t *watchBodyTracer) flush() {
+	for {
+		idx := bytes.IndexByte(t.buf.Bytes(), '\n')
+		if idx < 0 {
+			return
+		}
+
+		line := t.buf.Next(idx + 1)
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		printWatchFrame(line)
+	}
+}
+
+// printWatchFrame prints a summary of a single watch event to os.Stderr.
+func printWatchFrame(line []byte) {
+	var frame watchFrame
+	if err := json.Unmarshal(line, &frame); err != nil {
+		fmt.Fprintf(os.Stderr, "<< watch frame: %v\n", err)
+		return
+	}
+
+	meta := frame.Object.Metadata
+
+	name := meta.Name
+	if len(meta.Namespace) > 0 {
+		name = fmt.Sprintf("%s/%s", meta.Namespace, meta.Name)
+	}
+
+	fmt.Fprintf(os.Stderr, "<< %s %s %s (resourceVersion: %s)\n",
+		frame.Type, frame.Object.Kind, name, meta.ResourceVersion)
+}
+
+// isJSON returns true if the specified content type is JSON;
+// protobuf streams are not framed by newlines and are not traced.
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/chaos"
+	"github.com/lucasepe/using-client-go/pkg/controller"
+	"github.com/lucasepe/using-client-go/pkg/handler"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// go run main.go -rules rules.json -scenario informer -v 2
+func main() {
+	defaultKubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	if len(defaultKubeconfig) == 0 {
+		defaultKubeconfig = clientcmd.RecommendedHomeFile
+	}
+
+	kubeconfig := flag.String(clientcmd.RecommendedConfigPathFlag,
+		defaultKubeconfig, "absolute path to the kubeconfig file")
+
+	rulesFile := flag.String("rules", "rules.json", "JSON file with the faults to inject")
+
+	scenario := flag.String("scenario", "informer", "who has to deal with the faults: informer, retrywatcher or controller")
+
+	// register the klog flags (i.e. -v) to see what the reflector does
+	klog.InitFlags(nil)
+
+	flag.Parse()
+
+	run, ok := scenarios[*scenario]
+	if !ok {
+		panic(fmt.Sprintf("unknown scenario %q", *scenario))
+	}
+
+	rules, err := chaos.LoadRules(*rulesFile)
+	if err != nil {
+		panic(err)
+	}
+
+	rc, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		panic(err)
+	}
+
+	// wrap the default RoundTripper with the fault injector
+	// (invalid rules are reported here, not on the first request)
+	wrap, err := chaos.Wrap(rules...)
+	if err != nil {
+		panic(err)
+	}
+	rc.WrapTransport = wrap
+
+	clientSet, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		panic(err)
+	}
+
+	// canceled on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
+
+	// blocks until a signal is received
+	if err := run(ctx, clientSet, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		panic(err)
+	}
+}
+
+// scenarios maps the -scenario flag values to the functions running them
+var scenarios = map[string]func(context.Context, kubernetes.Interface, io.Writer) error{
+	"informer":     runInformer,
+	"retrywatcher": runRetryWatcher,
+	"controller":   runController,
+}
+
+// runInformer prints the pods seen by an informer: the reflector
+// retries the failed lists and watches, and relists on 410 Gone
+func runInformer(ctx context.Context, clientSet kubernetes.Interface, out io.Writer) error {
+	// the informer will have to deal with all the injected faults
+	informerFactory := informers.NewSharedInformerFactory(clientSet, time.Minute*1)
+
+	podsInformer := informerFactory.Core().V1().Pods()
+
+	podsInformer.Informer().AddEventHandler(handler.Funcs[*corev1.Pod]{
+		AddFunc: func(item *corev1.Pod) {
+			fmt.Fprintf(out, "pod added (ns=%s): %s\n", item.GetNamespace(), item.GetName())
+		},
+		UpdateFunc: func(_, item *corev1.Pod) {
+			fmt.Fprintf(out, "pod updated (ns=%s): %s\n", item.GetNamespace(), item.GetName())
+		},
+		// also called with the last known state of the pods whose deletion was missed
+		DeleteFunc: func(item *corev1.Pod) {
+			fmt.Fprintf(out, "pod deleted (ns=%s): %s\n", item.GetNamespace(), item.GetName())
+		},
+	})
+
+	informerFactory.Start(ctx.Done())
+
+	// despite the faults, the cache should eventually sync
+	if !cache.WaitForCacheSync(ctx.Done(), podsInformer.Informer().HasSynced) {
+		return ctx.Err()
+	}
+
+	fmt.Fprintln(out, "---- cache synced ----")
+
+	// then the informers stop
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// runRetryWatcher prints the pod events seen by a RetryWatcher: it
+// re-watches from the last resourceVersion when the stream breaks, but
+// gives up on 410 Gone, so here the pods are listed again (with retries)
+func runRetryWatcher(ctx context.Context, clientSet kubernetes.Interface, out io.Writer) error {
+	for {
+		rv, err := listPods(ctx, clientSet, out)
+		if err != nil {
+			return err
+		}
+
+		err = watchPods(ctx, clientSet, rv, out)
+		if !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+			return err
+		}
+
+		// the resourceVersion is too old, a new List is needed
+		fmt.Fprintf(out, "---- %v: listing again ----\n", err)
+	}
+}
+
+// listPods prints the current pods and returns the list resourceVersion;
+// the transient failures the client does not retry are retried here
+func listPods(ctx context.Context, clientSet kubernetes.Interface, out io.Writer) (string, error) {
+	var list *corev1.PodList
+	err := retry.OnError(retry.DefaultBackoff, transient, func() (err error) {
+		list, err = clientSet.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			fmt.Fprintf(out, "list failed: %v\n", err)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, el := range list.Items {
+		fmt.Fprintf(out, "pod listed (ns=%s): %s\n", el.GetNamespace(), el.GetName())
+	}
+	fmt.Fprintf(out, "---- %d pods (resourceVersion: %s) ----\n", len(list.Items), list.GetResourceVersion())
+
+	return list.GetResourceVersion(), nil
+}
+
+// watchPods prints the pod events starting from the specified
+// resourceVersion, until the context is done or an error event arrives
+func watchPods(ctx context.Context, clientSet kubernetes.Interface, rv string, out io.Writer) error {
+	rw, err := watchtools.NewRetryWatcher(rv, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return clientSet.CoreV1().Pods(metav1.NamespaceAll).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer rw.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-rw.ResultChan():
+			if !ok {
+				return fmt.Errorf("closed channel")
+			}
+
+			// the `RetryWatcher` gives up on errors like 410 Gone
+			if event.Type == watch.Error {
+				return apierrors.FromObject(event.Object)
+			}
+
+			if pod, ok := event.Object.(*corev1.Pod); ok {
+				fmt.Fprintf(out, "pod %s (ns=%s): %s\n", event.Type, pod.GetNamespace(), pod.GetName())
+			}
+		}
+	}
+}
+
+// transient tells if a failed request is worth retrying
+func transient(err error) bool {
+	return apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServerTimeout(err) ||
+		utilnet.IsConnectionReset(err) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// runController reconciles the pods with a controller: the reconciler
+// reads each pod from the API server (not from the cache), so the faults
+// injected there are retried by the queue, up to the dropped keys
+func runController(ctx context.Context, clientSet kubernetes.Interface, out io.Writer) error {
+	informerFactory := informers.NewSharedInformerFactory(clientSet, time.Minute*1)
+	podsInformer := informerFactory.Core().V1().Pods().Informer()
+
+	reconciler := controller.ReconcilerFunc(func(ctx context.Context, key controller.Key) (controller.Result, error) {
+		pod, err := clientSet.CoreV1().Pods(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			fmt.Fprintf(out, "pod %s does not exist anymore\n", key)
+			return controller.Result{}, nil
+		}
+		if err != nil {
+			fmt.Fprintf(out, "pod %s failed: %v\n", key, err)
+			return controller.Result{}, err
+		}
+
+		fmt.Fprintf(out, "pod %s reconciled (phase: %s)\n", key, pod.Status.Phase)
+		return controller.Result{}, nil
+	})
+
+	ctrl := controller.New(reconciler, controller.Options{
+		Name: "fault-injection",
+		OnDrop: func(_ context.Context, key controller.Key, retries int, err error) {
+			fmt.Fprintf(out, "pod %s dropped after %d retries: %v\n", key, retries, err)
+		},
+	})
+	controller.Watch[*corev1.Pod](ctrl, podsInformer)
+
+	informerFactory.Start(ctx.Done())
+
+	// waits for the cache to be synced, then runs until the context is done
+	return ctrl.Run(ctx, 2)
+}
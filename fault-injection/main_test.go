@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/chaos"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func pod(name, rv string) corev1.Pod {
+	return corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: rv},
+	}
+}
+
+// newAPIServer serves the pod "a" on lists and gets, then on
+// each watch the creation of the pod "b" (unknown to the gets)
+func newAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		switch {
+		case r.URL.Path == "/api/v1/pods" && r.URL.Query().Get("watch") == "true":
+			enc.Encode(metav1.WatchEvent{Type: "ADDED", Object: objectOf(pod("b", "11"))})
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+
+		case r.URL.Path == "/api/v1/pods":
+			enc.Encode(corev1.PodList{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+				ListMeta: metav1.ListMeta{ResourceVersion: "10"},
+				Items:    []corev1.Pod{pod("a", "9")},
+			})
+
+		case r.URL.Path == "/api/v1/namespaces/default/pods/a":
+			enc.Encode(pod("a", "9"))
+
+		default:
+			status := apierrors.NewNotFound(corev1.Resource("pods"), r.URL.Path).Status()
+			status.APIVersion, status.Kind = "v1", "Status"
+			w.WriteHeader(http.StatusNotFound)
+			enc.Encode(status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// objectOf returns the JSON of the object, as embedded in the watch events
+func objectOf(obj interface{}) (res runtime.RawExtension) {
+	res.Raw, _ = json.Marshal(obj)
+	return res
+}
+
+// runScenario runs the scenario against the fake API server, with the
+// faults injected, until the output contains all the expected lines
+func runScenario(t *testing.T, run func(context.Context, kubernetes.Interface, io.Writer) error, rules []chaos.Rule, expected ...string) string {
+	t.Helper()
+
+	wrap, err := chaos.Wrap(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{
+		Host:          newAPIServer(t).URL,
+		WrapTransport: wrap,
+		// no client side throttling
+		QPS: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := &syncBuffer{}
+	errCh := make(chan error, 1)
+	go func() { errCh <- run(ctx, cs, out) }()
+
+	deadline := time.After(10 * time.Second)
+	for !out.containsAll(expected) {
+		select {
+		case err := <-errCh:
+			t.Fatalf("stopped with %v, output:\n%s", err, out)
+		case <-deadline:
+			t.Fatalf("timed out, output:\n%s", out)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// a clean stop
+	cancel()
+	if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func TestRetryWatcherListsAgainOnGone(t *testing.T) {
+	got := runScenario(t, runRetryWatcher, []chaos.Rule{
+		{Path: "^/api/v1/pods$", Fault: chaos.ServiceUnavailable, Count: 1},
+		{Path: "^/api/v1/pods$", Fault: chaos.Gone, WatchOnly: true, Count: 1},
+	},
+		"list failed: ",
+		": listing again ----",
+		"pod ADDED (ns=default): b",
+	)
+
+	// listed again after the 410
+	if n := strings.Count(got, "pod listed (ns=default): a"); n != 2 {
+		t.Fatalf("listed %d times, expected 2; output:\n%s", n, got)
+	}
+}
+
+func TestControllerRetriesTheFailures(t *testing.T) {
+	got := runScenario(t, runController, []chaos.Rule{
+		{Path: "^/api/v1/namespaces/default/pods/a$", Fault: chaos.InternalError, Count: 2},
+	},
+		"pod default/a reconciled",
+		"pod default/b does not exist anymore",
+	)
+
+	if n := strings.Count(got, "pod default/a failed: "); n != 2 {
+		t.Fatalf("failed %d times, expected 2; output:\n%s", n, got)
+	}
+	if strings.Contains(got, "dropped") {
+		t.Fatalf("unexpected dropped pods; output:\n%s", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) containsAll(lines []string) bool {
+	s := b.String()
+	for _, el := range lines {
+		if !strings.Contains(s, el) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/controller"
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	"github.com/lucasepe/using-client-go/pkg/recorder"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// go run main.go -policy policy.yaml -dry-run
+func main() {
+	defaultKubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	if len(defaultKubeconfig) == 0 {
+		defaultKubeconfig = clientcmd.RecommendedHomeFile
+	}
+
+	kubeconfig := flag.String(clientcmd.RecommendedConfigPathFlag,
+		defaultKubeconfig, "absolute path to the kubeconfig file")
+
+	policyFile := flag.String("policy", "policy.yaml", "YAML file with the policy rules")
+	dryRun := flag.Bool("dry-run", false, "validate the changes on the API server without persisting them")
+	reconcileEvery := flag.Duration("reconcile-every", 5*time.Minute, "how often all the namespaces are checked for drift")
+	workers := flag.Int("workers", 2, "number of workers enforcing the policy")
+
+	klog.InitFlags(nil)
+
+	flag.Parse()
+
+	pol, err := policy.Load(*policyFile)
+	if err != nil {
+		panic(err)
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		panic(err)
+	}
+
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	enforcer := policy.NewEnforcer(cs, pol, "namespace-policy")
+	enforcer.DryRun = *dryRun
+
+	// records the Events about the namespaces we fix
+	rec := recorder.New(cs, scheme.Scheme, "namespace-policy")
+	defer rec.Flush(5 * time.Second)
+
+	// the resync period is the drift reconciliation period:
+	// at every resync all the namespaces are enqueued again
+	factory := informers.NewSharedInformerFactory(cs, *reconcileEvery)
+	nsInformer := factory.Core().V1().Namespaces()
+
+	// namespaces are cluster scoped: the key is just the name; the
+	// namespaces are enforced on creation (and on startup, for the
+	// existing ones) and at every update (resyncs included)
+	ctrl := controller.New(&reconciler{
+		namespaces: controller.NewLister[*corev1.Namespace](nsInformer.Informer()),
+		enforcer:   enforcer,
+		recorder:   rec,
+	}, controller.Options{Name: "namespace-policy"})
+
+	controller.Watch[*corev1.Namespace](ctrl, nsInformer.Informer())
+
+	// canceled on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
+
+	factory.Start(ctx.Done())
+
+	klog.InfoS("Enforcing namespace policy", "rules", len(pol.Rules), "dryRun", *dryRun)
+
+	// returns once the queue has been drained (or, if stopped
+	// before the caches were synced, with context.Canceled)
+	if err := ctrl.Run(ctx, *workers); err != nil && !errors.Is(err, context.Canceled) {
+		klog.Fatal(err)
+	}
+}
+
+// reconciler makes the namespaces comply with the policy
+type reconciler struct {
+	namespaces controller.Lister[*corev1.Namespace]
+	enforcer   *policy.Enforcer
+	recorder   record.EventRecorder
+}
+
+// Reconcile enforces the policy on the namespace, if it still exists
+func (r *reconciler) Reconcile(ctx context.Context, key controller.Key) (controller.Result, error) {
+	ns, exists, err := r.namespaces.Get(key)
+	if err != nil || !exists {
+		// deleted meanwhile, nothing to do
+		return controller.Result{}, err
+	}
+
+	// leave alone the namespaces being deleted
+	if ns.Status.Phase == corev1.NamespaceTerminating {
+		return controller.Result{}, nil
+	}
+
+	actions, err := r.enforcer.Enforce(ctx, ns)
+	if err != nil {
+		r.recorder.Eventf(ns, corev1.EventTypeWarning, "PolicyFailed", "Policy not enforced: %v", err)
+		return controller.Result{}, err
+	}
+
+	if len(actions) == 0 {
+		return controller.Result{}, nil
+	}
+
+	msg := strings.Join(actions, ", ")
+	if r.enforcer.DryRun {
+		fmt.Printf("~ '%s' (dry run) %s\n", key.Name, msg)
+		return controller.Result{}, nil
+	}
+
+	fmt.Printf("~ '%s' %s\n", key.Name, msg)
+	r.recorder.Eventf(ns, corev1.EventTypeNormal, "PolicyEnforced", "Policy enforced: %s", msg)
+
+	return controller.Result{}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/controller"
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// newReconciler returns a reconciler enforcing the default policy
+// on the namespaces served by a fake clientset
+func newReconciler(t *testing.T, cs *fake.Clientset, dryRun bool) (*reconciler, *record.FakeRecorder) {
+	t.Helper()
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	informer := factory.Core().V1().Namespaces().Informer()
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("failed to sync")
+	}
+
+	enforcer := policy.NewEnforcer(cs, policy.Default(), "namespace-policy")
+	enforcer.DryRun = dryRun
+
+	rec := record.NewFakeRecorder(10)
+
+	return &reconciler{
+		namespaces: controller.NewLister[*corev1.Namespace](informer),
+		enforcer:   enforcer,
+		recorder:   rec,
+	}, rec
+}
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// events returns the recorded events
+func events(rec *record.FakeRecorder) []string {
+	var res []string
+	for {
+		select {
+		case el := <-rec.Events:
+			res = append(res, el)
+		default:
+			return res
+		}
+	}
+}
+
+func TestReconcileRecordsPolicyEnforced(t *testing.T) {
+	cs := fake.NewSimpleClientset(namespace("demo", nil))
+	r, rec := newReconciler(t, cs, false)
+
+	if _, err := r.Reconcile(context.TODO(), controller.Key{Name: "demo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := events(rec)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "Normal PolicyEnforced Policy enforced: patched metadata") {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
+
+func TestReconcileCompliantRecordsNothing(t *testing.T) {
+	cs := fake.NewSimpleClientset(namespace("demo", map[string]string{"modified-by": "lucasepe"}))
+	r, rec := newReconciler(t, cs, false)
+
+	if _, err := r.Reconcile(context.TODO(), controller.Key{Name: "demo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := events(rec); len(got) != 0 {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
+
+func TestReconcileDryRunRecordsNothing(t *testing.T) {
+	cs := fake.NewSimpleClientset(namespace("demo", nil))
+	r, rec := newReconciler(t, cs, true)
+
+	if _, err := r.Reconcile(context.TODO(), controller.Key{Name: "demo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := events(rec); len(got) != 0 {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
+
+func TestReconcileRecordsPolicyFailed(t *testing.T) {
+	cs := fake.NewSimpleClientset(namespace("demo", nil))
+	cs.PrependReactor("patch", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	r, rec := newReconciler(t, cs, false)
+
+	if _, err := r.Reconcile(context.TODO(), controller.Key{Name: "demo"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	got := events(rec)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "Warning PolicyFailed Policy not enforced:") {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
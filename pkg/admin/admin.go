@@ -0,0 +1,155 @@
+// Package admin is the HTTP server a controller process exposes to
+// the kubelet and to the operators:
+//
+//	/healthz        the process is alive
+//	/readyz         all the readiness checks pass (?verbose lists them)
+//	/metrics        the Prometheus metrics
+//	/debug/pprof/   the Go profiler
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Check returns an error when the process is not ready.
+type Check func() error
+
+// Server is the admin HTTP server.
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// New returns a `Server` listening on addr, exposing the metrics
+// of the gatherer (i.e. prometheus.DefaultGatherer).
+func New(addr string, gatherer prometheus.Gatherer) *Server {
+	s := &Server{
+		addr:   addr,
+		mux:    http.NewServeMux(),
+		checks: map[string]Check{},
+	}
+
+	s.mux.HandleFunc("/healthz", func(wri http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(wri, "ok")
+	})
+	s.mux.HandleFunc("/readyz", s.readyz)
+	s.mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return s
+}
+
+// AddReadyCheck adds a named readiness check.
+func (s *Server) AddReadyCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = check
+}
+
+// Handle registers an additional handler.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the handler serving all the endpoints.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Run serves until the context is done, then shuts down the server.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: s.mux}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	klog.InfoS("Serving admin endpoints", "addr", ln.Addr().String())
+
+	err = srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// readyz responds 200 when all the checks pass, 503 otherwise;
+// with ?verbose the outcome of every check is listed
+func (s *Server) readyz(wri http.ResponseWriter, req *http.Request) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var report strings.Builder
+	failed := false
+	for _, name := range names {
+		if err := s.checks[name](); err != nil {
+			failed = true
+			fmt.Fprintf(&report, "[-]%s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&report, "[+]%s ok\n", name)
+		}
+	}
+	s.mu.RUnlock()
+
+	wri.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	wri.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if failed {
+		wri.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(wri, report.String())
+		fmt.Fprintln(wri, "readyz check failed")
+		return
+	}
+
+	if _, verbose := req.URL.Query()["verbose"]; verbose {
+		fmt.Fprint(wri, report.String())
+	}
+	fmt.Fprintln(wri, "ok")
+}
+
+// Synced is a Check passing once all the informers have synced.
+func Synced(synced ...cache.InformerSynced) Check {
+	return func() error {
+		for _, fn := range synced {
+			if !fn() {
+				return fmt.Errorf("caches not synced")
+			}
+		}
+		return nil
+	}
+}
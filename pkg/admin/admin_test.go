@@ -0,0 +1,164 @@
+package admin_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/admin"
+	"github.com/lucasepe/using-client-go/pkg/leader"
+	"github.com/lucasepe/using-client-go/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// the workqueue metrics provider can be set only once per process
+var registry = func() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	metrics.RegisterWorkqueue(reg)
+	return reg
+}()
+
+func get(t *testing.T, srv *httptest.Server, path string) (int, string) {
+	t.Helper()
+
+	res, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, string(body)
+}
+
+func TestReadyzAfterCacheSync(t *testing.T) {
+	var synced int32
+	hasSynced := func() bool { return atomic.LoadInt32(&synced) == 1 }
+
+	s := admin.New("", registry)
+	s.AddReadyCheck("informers", admin.Synced(hasSynced))
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	if code, _ := get(t, srv, "/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz: got %d, expected 200 (the process is alive)", code)
+	}
+
+	code, body := get(t, srv, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz before the sync: got %d, expected 503", code)
+	}
+	if !strings.Contains(body, "[-]informers failed") {
+		t.Fatalf("/readyz before the sync: unexpected body %q", body)
+	}
+
+	atomic.StoreInt32(&synced, 1)
+
+	code, body = get(t, srv, "/readyz?verbose")
+	if code != http.StatusOK {
+		t.Fatalf("/readyz after the sync: got %d, expected 200", code)
+	}
+	if !strings.Contains(body, "[+]informers ok") {
+		t.Fatalf("/readyz after the sync: unexpected body %q", body)
+	}
+}
+
+func TestReadyzLeaderCheck(t *testing.T) {
+	elector, err := leader.New(fake.NewSimpleClientset(), leader.Config{
+		Namespace:     "default",
+		Name:          "test-lease",
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}, func(ctx context.Context) { <-ctx.Done() })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := admin.New("", registry)
+	s.AddReadyCheck("informers", admin.Synced(func() bool { return true }))
+	s.AddReadyCheck("leader", elector.Ready)
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	// no election yet
+	if code, body := get(t, srv, "/readyz"); code != http.StatusServiceUnavailable ||
+		!strings.Contains(body, "[-]leader failed") {
+		t.Fatalf("/readyz before the election: got %d %q, expected 503", code, body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elector.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, _ := get(t, srv, "/readyz")
+		if code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/readyz after the election: got %d, expected 200", code)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	// a new queue for every run (i.e. -count)
+	name := fmt.Sprintf("admin-%d", time.Now().UnixNano())
+
+	q := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name)
+	defer q.ShutDown()
+
+	q.Add("a")
+	item, _ := q.Get()
+	q.AddRateLimited(item)
+	q.Done(item)
+
+	srv := httptest.NewServer(admin.New("", registry).Handler())
+	defer srv.Close()
+
+	code, body := get(t, srv, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("/metrics: got %d, expected 200", code)
+	}
+
+	for _, el := range []string{
+		fmt.Sprintf("workqueue_depth{name=%q}", name),
+		fmt.Sprintf("workqueue_adds_total{name=%q}", name),
+		fmt.Sprintf("workqueue_queue_duration_seconds_count{name=%q}", name),
+		fmt.Sprintf("workqueue_work_duration_seconds_count{name=%q}", name),
+		fmt.Sprintf("workqueue_unfinished_work_seconds{name=%q}", name),
+		fmt.Sprintf("workqueue_retries_total{name=%q} 1", name),
+	} {
+		if !strings.Contains(body, el) {
+			t.Errorf("/metrics: %s not found", el)
+		}
+	}
+
+	if code, _ := get(t, srv, "/debug/pprof/"); code != http.StatusOK {
+		t.Fatalf("/debug/pprof/: got %d, expected 200", code)
+	}
+}
@@ -0,0 +1,336 @@
+// Package chaos provides an http.RoundTripper that injects faults in the
+// calls made by a client-go client, so that watchers, informers and
+// controllers can be exercised against a misbehaving API server.
+//
+// Plug it in using the rest.Config WrapTransport hook:
+//
+//	wrap, err := chaos.Wrap(rules...)
+//	...
+//	rc.WrapTransport = wrap
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Fault is the kind of failure injected by a Rule.
+type Fault string
+
+const (
+	// Latency delays the request by Rule.Delay before forwarding it.
+	Latency Fault = "latency"
+	// ConnectionReset fails the request with a "connection reset by peer" error.
+	ConnectionReset Fault = "reset"
+	// TooManyRequests answers 429 with a Retry-After header.
+	TooManyRequests Fault = "429"
+	// InternalError answers 500.
+	InternalError Fault = "500"
+	// ServiceUnavailable answers 503.
+	ServiceUnavailable Fault = "503"
+	// Gone answers 410; on watches the 410 is streamed as an ERROR event,
+	// just like the API server does when the resourceVersion is too old.
+	Gone Fault = "410"
+	// TruncatedBody forwards the request and cuts the
+	// response body after Rule.TruncateAfter bytes.
+	TruncatedBody Fault = "truncate"
+)
+
+// Rule describes when and how a fault is injected.
+type Rule struct {
+	// Path is a regular expression matched against the request URL path;
+	// empty matches every path.
+	Path string `json:"path,omitempty"`
+	// Method restricts the rule to an HTTP method; empty matches every method.
+	Method string `json:"method,omitempty"`
+	// WatchOnly restricts the rule to watch requests.
+	WatchOnly bool `json:"watchOnly,omitempty"`
+	// Fault is the failure to inject.
+	Fault Fault `json:"fault"`
+	// Probability of injecting the fault on a matching request, in (0, 1];
+	// zero means every matching request.
+	Probability float64 `json:"probability,omitempty"`
+	// Count is the maximum number of injections; zero means unlimited.
+	Count int `json:"count,omitempty"`
+	// Delay is the latency added by the Latency fault.
+	Delay metav1.Duration `json:"delay,omitempty"`
+	// RetryAfter is the Retry-After value (in seconds) of the TooManyRequests fault.
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// TruncateAfter is the number of bytes returned by the TruncatedBody fault.
+	TruncateAfter int64 `json:"truncateAfter,omitempty"`
+}
+
+// rule is a compiled Rule that keeps track of its injections.
+type rule struct {
+	Rule
+	re       *regexp.Regexp
+	injected int
+}
+
+// Transport implements http.RoundTripper.  It injects the
+// faults described by its rules; the first matching rule wins.
+type Transport struct {
+	http.RoundTripper
+
+	mu    sync.Mutex
+	rules []*rule
+	rnd   *rand.Rand
+}
+
+// NewTransport returns a new `Transport` wrapping the given
+// RoundTripper; it fails if a rule is not valid.
+func NewTransport(rt http.RoundTripper, rules ...Rule) (*Transport, error) {
+	compiled, err := compile(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transport{
+		RoundTripper: rt,
+		rules:        compiled,
+		rnd:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Wrap returns a function suitable for the rest.Config WrapTransport
+// field; it fails if a rule is not valid.  Every wrapped RoundTripper
+// keeps its own injection counters.
+func Wrap(rules ...Rule) (func(http.RoundTripper) http.RoundTripper, error) {
+	// fail now, not when the client is created
+	if _, err := compile(rules); err != nil {
+		return nil, err
+	}
+
+	return func(rt http.RoundTripper) http.RoundTripper {
+		t, _ := NewTransport(rt, rules...)
+		return t
+	}, nil
+}
+
+// compile validates the rules and compiles their path regexes.
+func compile(rules []Rule) ([]*rule, error) {
+	res := make([]*rule, 0, len(rules))
+
+	for i, el := range rules {
+		re, err := regexp.Compile(el.Path)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid path regex %q: %w", i, el.Path, err)
+		}
+
+		switch el.Fault {
+		case Latency, ConnectionReset, TooManyRequests,
+			InternalError, ServiceUnavailable, Gone, TruncatedBody:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown fault %q", i, el.Fault)
+		}
+
+		if el.Probability < 0 || el.Probability > 1 {
+			return nil, fmt.Errorf("rule %d: probability %v not in (0, 1]", i, el.Probability)
+		}
+		if el.Count < 0 {
+			return nil, fmt.Errorf("rule %d: negative count %d", i, el.Count)
+		}
+
+		res = append(res, &rule{Rule: el, re: re})
+	}
+
+	return res, nil
+}
+
+// LoadRules reads a JSON array of rules from the specified file.
+func LoadRules(filename string) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", filename, err)
+	}
+
+	return rules, nil
+}
+
+// RoundTrip injects the fault of the first matching rule, if any,
+// otherwise it simply calls the nested RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	watching := req.URL.Query().Get("watch") == "true"
+
+	r := t.match(req, watching)
+	if r == nil {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	switch r.Fault {
+	case Latency:
+		select {
+		case <-time.After(r.Delay.Duration):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		return t.RoundTripper.RoundTrip(req)
+
+	case ConnectionReset:
+		return nil, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+
+	case TooManyRequests:
+		resp := statusResponse(req, http.StatusTooManyRequests,
+			metav1.StatusReasonTooManyRequests, "injected: too many requests")
+		resp.Header.Set("Retry-After", strconv.Itoa(r.RetryAfter))
+		return resp, nil
+
+	case InternalError:
+		return statusResponse(req, http.StatusInternalServerError,
+			metav1.StatusReasonInternalError, "injected: internal error"), nil
+
+	case ServiceUnavailable:
+		return statusResponse(req, http.StatusServiceUnavailable,
+			metav1.StatusReasonServiceUnavailable, "injected: service unavailable"), nil
+
+	case Gone:
+		if watching {
+			return goneWatchResponse(req), nil
+		}
+		return statusResponse(req, http.StatusGone,
+			metav1.StatusReasonExpired, "injected: resource version too old"), nil
+
+	case TruncatedBody:
+		resp, err := t.RoundTripper.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		resp.Body = &truncatedBody{
+			ReadCloser: resp.Body,
+			remaining:  r.TruncateAfter,
+		}
+		// the declared length would no longer be correct
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		return resp, nil
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// match returns the first rule matching the request and
+// updates its injection counter; nil if no rule applies.
+func (t *Transport) match(req *http.Request, watching bool) *rule {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, r := range t.rules {
+		if r.Count > 0 && r.injected >= r.Count {
+			continue
+		}
+		if len(r.Method) > 0 && r.Method != req.Method {
+			continue
+		}
+		if r.WatchOnly && !watching {
+			continue
+		}
+		if !r.re.MatchString(req.URL.Path) {
+			continue
+		}
+		if r.Probability > 0 && t.rnd.Float64() >= r.Probability {
+			continue
+		}
+
+		r.injected++
+		return r
+	}
+
+	return nil
+}
+
+// statusResponse returns a response with a `metav1.Status` body,
+// exactly like the ones sent by the API server on failures.
+func statusResponse(req *http.Request, code int, reason metav1.StatusReason, msg string) *http.Response {
+	body, _ := json.Marshal(newStatus(code, reason, msg))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// goneWatchResponse returns a watch stream made of a single ERROR event
+// carrying a 410 status, the way the API server expires a watch.
+func goneWatchResponse(req *http.Request) *http.Response {
+	status := newStatus(http.StatusGone, metav1.StatusReasonExpired,
+		"injected: too old resource version")
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":   "ERROR",
+		"object": status,
+	})
+	body = append(body, '\n')
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header: http.Header{
+			"Content-Type":      []string{"application/json"},
+			"Transfer-Encoding": []string{"chunked"},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+// newStatus returns a failure `metav1.Status`.
+func newStatus(code int, reason metav1.StatusReason, msg string) *metav1.Status {
+	return &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  msg,
+	}
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF after `remaining` bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
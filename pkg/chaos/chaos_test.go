@@ -0,0 +1,342 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const payload = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// server is an API server answering every request with the payload
+type server struct {
+	*httptest.Server
+	hits int64
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.hits, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, payload)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *server) forwarded() int {
+	return int(atomic.LoadInt64(&s.hits))
+}
+
+func newTransport(t *testing.T, rules ...Rule) *Transport {
+	t.Helper()
+
+	tr, err := NewTransport(http.DefaultTransport, rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// do sends a request through the transport
+func do(t *testing.T, tr http.RoundTripper, method, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr.RoundTrip(req)
+}
+
+// code returns the response status code (0 on errors), closing the body
+func code(t *testing.T, tr http.RoundTripper, method, url string) int {
+	t.Helper()
+
+	resp, err := do(t, tr, method, url)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRuleMatching(t *testing.T) {
+	srv := newServer(t)
+
+	tr := newTransport(t,
+		Rule{Path: "^/api/v1/pods$", Method: http.MethodDelete, Fault: InternalError},
+		Rule{Path: "^/api/v1/pods$", WatchOnly: true, Fault: ServiceUnavailable},
+		// shadowed by the previous one on watches
+		Rule{Path: "/pods", Fault: TooManyRequests},
+	)
+
+	tests := []struct {
+		method, path string
+		expected     int
+	}{
+		{http.MethodDelete, "/api/v1/pods", http.StatusInternalServerError},
+		{http.MethodGet, "/api/v1/pods?watch=true", http.StatusServiceUnavailable},
+		{http.MethodGet, "/api/v1/pods", http.StatusTooManyRequests},
+		{http.MethodGet, "/api/v1/namespaces/default/pods?watch=true", http.StatusTooManyRequests},
+		// no rule matching
+		{http.MethodGet, "/api/v1/namespaces", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		if got := code(t, tr, tc.method, srv.URL+tc.path); got != tc.expected {
+			t.Errorf("%s %s: got %d, expected %d", tc.method, tc.path, got, tc.expected)
+		}
+	}
+
+	if got := srv.forwarded(); got != 1 {
+		t.Fatalf("%d requests reached the server, expected 1", got)
+	}
+}
+
+func TestCount(t *testing.T) {
+	srv := newServer(t)
+	tr := newTransport(t, Rule{Fault: InternalError, Count: 2})
+
+	var got []int
+	for i := 0; i < 4; i++ {
+		got = append(got, code(t, tr, http.MethodGet, srv.URL))
+	}
+
+	expected := []int{500, 500, 200, 200}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", got, expected)
+		}
+	}
+}
+
+func TestProbability(t *testing.T) {
+	srv := newServer(t)
+	tr := newTransport(t, Rule{Fault: InternalError, Probability: 0.3})
+	// deterministic
+	tr.rnd = rand.New(rand.NewSource(1))
+
+	injected := 0
+	for i := 0; i < 1000; i++ {
+		if code(t, tr, http.MethodGet, srv.URL) == http.StatusInternalServerError {
+			injected++
+		}
+	}
+
+	if injected < 250 || injected > 350 {
+		t.Fatalf("injected %d faults out of 1000, expected about 300", injected)
+	}
+}
+
+func TestStatusFaults(t *testing.T) {
+	srv := newServer(t)
+
+	tests := map[Fault]func(error) bool{
+		TooManyRequests:    apierrors.IsTooManyRequests,
+		InternalError:      apierrors.IsInternalError,
+		ServiceUnavailable: apierrors.IsServiceUnavailable,
+		Gone:               apierrors.IsResourceExpired,
+	}
+
+	for fault, is := range tests {
+		tr := newTransport(t, Rule{Fault: fault, RetryAfter: 3})
+
+		resp, err := do(t, tr, http.MethodGet, srv.URL+"/api/v1/pods")
+		if err != nil {
+			t.Fatalf("%s: %v", fault, err)
+		}
+
+		// the body is a metav1.Status, like the API server ones
+		status := &metav1.Status{}
+		err = json.NewDecoder(resp.Body).Decode(status)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", fault, err)
+		}
+
+		if int(status.Code) != resp.StatusCode {
+			t.Errorf("%s: got code %d, status %d", fault, resp.StatusCode, status.Code)
+		}
+		if !is(&apierrors.StatusError{ErrStatus: *status}) {
+			t.Errorf("%s: unexpected status %+v", fault, status)
+		}
+		if fault == TooManyRequests && resp.Header.Get("Retry-After") != "3" {
+			t.Errorf("%s: got Retry-After %q, expected 3", fault, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	if got := srv.forwarded(); got != 0 {
+		t.Fatalf("%d requests reached the server, expected none", got)
+	}
+}
+
+func TestGoneOnWatch(t *testing.T) {
+	srv := newServer(t)
+
+	wrap, err := Wrap(Rule{Path: "/pods", Fault: Gone, WatchOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, WrapTransport: wrap})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := cs.CoreV1().Pods("").Watch(context.TODO(), metav1.ListOptions{ResourceVersion: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// streamed as an ERROR event, like the API server does
+	select {
+	case event := <-w.ResultChan():
+		if event.Type != watch.Error {
+			t.Fatalf("got a %s event, expected an ERROR", event.Type)
+		}
+		if err := apierrors.FromObject(event.Object); !apierrors.IsResourceExpired(err) {
+			t.Fatalf("got %v, expected an expired error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestConnectionReset(t *testing.T) {
+	srv := newServer(t)
+	tr := newTransport(t, Rule{Fault: ConnectionReset})
+
+	_, err := do(t, tr, http.MethodGet, srv.URL)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("got %v, expected a connection reset", err)
+	}
+	if got := srv.forwarded(); got != 0 {
+		t.Fatalf("%d requests reached the server, expected none", got)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	srv := newServer(t)
+	tr := newTransport(t, Rule{Fault: Latency, Delay: metav1.Duration{Duration: 100 * time.Millisecond}})
+
+	start := time.Now()
+	if got := code(t, tr, http.MethodGet, srv.URL); got != http.StatusOK {
+		t.Fatalf("got %d, expected 200", got)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("answered after %s, expected at least 100ms", elapsed)
+	}
+
+	// the caller gives up first
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected the context error", err)
+	}
+	if got := srv.forwarded(); got != 1 {
+		t.Fatalf("%d requests reached the server, expected 1", got)
+	}
+}
+
+func TestTruncatedBody(t *testing.T) {
+	srv := newServer(t)
+	tr := newTransport(t, Rule{Fault: TruncatedBody, TruncateAfter: 10})
+
+	resp, err := do(t, tr, http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength != -1 || len(resp.Header.Get("Content-Length")) > 0 {
+		t.Fatalf("the length of the whole body is still declared")
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, expected io.ErrUnexpectedEOF", err)
+	}
+	if string(got) != payload[:10] {
+		t.Fatalf("got %q, expected %q", got, payload[:10])
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := map[string]Rule{
+		"regex":       {Path: "(", Fault: Gone},
+		"fault":       {Fault: "404"},
+		"probability": {Fault: Gone, Probability: 1.5},
+		"count":       {Fault: Gone, Count: -1},
+	}
+
+	for name, r := range tests {
+		if _, err := NewTransport(http.DefaultTransport, r); err == nil {
+			t.Errorf("%s: NewTransport accepted an invalid rule", name)
+		}
+		if _, err := Wrap(Rule{Fault: Gone}, r); err == nil {
+			t.Errorf("%s: Wrap accepted an invalid rule", name)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"path": "/pods", "fault": "latency", "delay": "2s", "probability": 0.5, "count": 3}]`
+	if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadRules(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Rule{Path: "/pods", Fault: Latency, Delay: metav1.Duration{Duration: 2 * time.Second}, Probability: 0.5, Count: 3}
+	if len(rules) != 1 || rules[0] != expected {
+		t.Fatalf("got %+v, expected %+v", rules, expected)
+	}
+
+	// the rules of the example are valid
+	rules, err = LoadRules("../../fault-injection/rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Wrap(rules...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filename, []byte(`{"fault": "410"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(filename); err == nil || !strings.Contains(err.Error(), filename) {
+		t.Fatalf("got %v, expected an error about %s", err, filename)
+	}
+}
@@ -0,0 +1,84 @@
+// Package checkpoint persists the progress of a watch, so that
+// a process can resume watching from where it stopped.
+package checkpoint
+
+import (
+	"context"
+	"sort"
+)
+
+// Checkpoint is the state of a watch.
+type Checkpoint struct {
+	// ResourceVersion is the last processed resourceVersion;
+	// the watch will be resumed from this value.
+	ResourceVersion string `json:"resourceVersion"`
+
+	// Objects maps the key of each known object to its
+	// resourceVersion; when the ResourceVersion is too old
+	// (410 Gone) a fresh List is compared against it.
+	Objects map[string]string `json:"objects,omitempty"`
+}
+
+// New returns an empty checkpoint.
+func New() *Checkpoint {
+	return &Checkpoint{Objects: map[string]string{}}
+}
+
+// DeepCopy returns a copy of the checkpoint, not sharing the Objects.
+func (cp *Checkpoint) DeepCopy() *Checkpoint {
+	res := &Checkpoint{
+		ResourceVersion: cp.ResourceVersion,
+		Objects:         make(map[string]string, len(cp.Objects)),
+	}
+	for key, rv := range cp.Objects {
+		res.Objects[key] = rv
+	}
+	return res
+}
+
+// Store knows how to load and save a checkpoint.
+type Store interface {
+	// Load returns the saved checkpoint or an
+	// empty one if nothing has been saved yet.
+	Load(ctx context.Context) (*Checkpoint, error)
+
+	// Save persists the specified checkpoint.
+	Save(ctx context.Context, cp *Checkpoint) error
+}
+
+// Diff holds the differences between the known
+// objects and the objects found by a new List.
+type Diff struct {
+	Added    []string
+	Modified []string
+	Deleted  []string
+}
+
+// Diff compares the known objects against the specified ones
+// (key => resourceVersion) returned by a fresh List.
+func (cp *Checkpoint) Diff(current map[string]string) Diff {
+	var res Diff
+
+	for key, rv := range current {
+		old, ok := cp.Objects[key]
+		if !ok {
+			res.Added = append(res.Added, key)
+			continue
+		}
+		if old != rv {
+			res.Modified = append(res.Modified, key)
+		}
+	}
+
+	for key := range cp.Objects {
+		if _, ok := current[key]; !ok {
+			res.Deleted = append(res.Deleted, key)
+		}
+	}
+
+	sort.Strings(res.Added)
+	sort.Strings(res.Modified)
+	sort.Strings(res.Deleted)
+
+	return res
+}
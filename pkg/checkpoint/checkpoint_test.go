@@ -0,0 +1,39 @@
+package checkpoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	cp := New()
+	cp.Objects = map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}
+
+	got := cp.Diff(map[string]string{"a": "1", "b": "5", "d": "6", "e": "7", "f": "8"})
+
+	expected := Diff{
+		Added:    []string{"e", "f"},
+		Modified: []string{"b", "d"},
+		Deleted:  []string{"c"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+
+	// nothing known yet: everything is new
+	got = New().Diff(map[string]string{"b": "1", "a": "2"})
+	if expected := (Diff{Added: []string{"a", "b"}}); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	cp := &Checkpoint{ResourceVersion: "10", Objects: map[string]string{"a": "1"}}
+
+	res := cp.DeepCopy()
+	cp.Objects["b"] = "2"
+
+	if expected := (&Checkpoint{ResourceVersion: "10", Objects: map[string]string{"a": "1"}}); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("got %+v, expected %+v", res, expected)
+	}
+}
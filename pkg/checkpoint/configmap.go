@@ -0,0 +1,95 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// configMapKey is the ConfigMap data key holding the checkpoint.
+const configMapKey = "checkpoint.json"
+
+// ConfigMapStore saves the checkpoint in a ConfigMap,
+// useful when the process has no persistent volume.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore returns a `Store` using the
+// ConfigMap with the specified namespace and name.
+func NewConfigMapStore(cs kubernetes.Interface, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    cs,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load reads the checkpoint from the ConfigMap.
+func (s *ConfigMapStore) Load(ctx context.Context) (*Checkpoint, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).
+		Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return New(), nil
+		}
+		return nil, err
+	}
+
+	cp := New()
+
+	data, ok := cm.Data[configMapKey]
+	if !ok {
+		return cp, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), cp); err != nil {
+		return nil, err
+	}
+	if cp.Objects == nil {
+		cp.Objects = map[string]string{}
+	}
+
+	return cp, nil
+}
+
+// Save writes the checkpoint in the ConfigMap, creating it if needed.
+func (s *ConfigMapStore) Save(ctx context.Context, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	cmc := s.client.CoreV1().ConfigMaps(s.namespace)
+
+	cm, err := cmc.Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = cmc.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.name,
+				Namespace: s.namespace,
+			},
+			Data: map[string]string{configMapKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapKey] = string(data)
+
+	_, err = cmc.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+var _ Store = (*ConfigMapStore)(nil)
@@ -0,0 +1,83 @@
+package checkpoint
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapStore(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	store := NewConfigMapStore(cs, "default", "checkpoint")
+
+	// no ConfigMap yet
+	cp, err := store.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cp, New()) {
+		t.Fatalf("got %+v, expected an empty checkpoint", cp)
+	}
+
+	// created, then updated
+	for _, rv := range []string{"10", "11"} {
+		cp.ResourceVersion = rv
+		cp.Objects["a"] = rv
+		if err := store.Save(context.TODO(), cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := store.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&Checkpoint{ResourceVersion: "11", Objects: map[string]string{"a": "11"}}); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestConfigMapStoreKeepsTheOtherKeys(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "checkpoint"},
+		Data:       map[string]string{"owner": "me"},
+	})
+	store := NewConfigMapStore(cs, "default", "checkpoint")
+
+	// no checkpoint key yet
+	cp, err := store.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cp, New()) {
+		t.Fatalf("got %+v, expected an empty checkpoint", cp)
+	}
+
+	cp.ResourceVersion = "10"
+	if err := store.Save(context.TODO(), cp); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := cs.CoreV1().ConfigMaps("default").Get(context.TODO(), "checkpoint", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["owner"] != "me" || len(cm.Data[configMapKey]) == 0 {
+		t.Fatalf("unexpected data %v", cm.Data)
+	}
+}
+
+func TestConfigMapStoreCorrupted(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "checkpoint"},
+		Data:       map[string]string{configMapKey: "{"},
+	})
+
+	if _, err := NewConfigMapStore(cs, "default", "checkpoint").Load(context.TODO()); err == nil {
+		t.Fatal("a corrupted checkpoint has been loaded")
+	}
+}
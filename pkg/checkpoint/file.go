@@ -0,0 +1,72 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore saves the checkpoint as a JSON file.
+type FileStore struct {
+	filename string
+}
+
+// NewFileStore returns a `Store` using the specified file.
+func NewFileStore(filename string) *FileStore {
+	return &FileStore{filename: filename}
+}
+
+// Load reads the checkpoint from the file.
+func (s *FileStore) Load(_ context.Context) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return New(), nil
+		}
+		return nil, err
+	}
+
+	cp := New()
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if cp.Objects == nil {
+		cp.Objects = map[string]string{}
+	}
+
+	return cp, nil
+}
+
+// Save writes the checkpoint to a temporary file and then renames it,
+// so a crash while writing never leaves a corrupted checkpoint behind.
+func (s *FileStore) Save(_ context.Context, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+var _ Store = (*FileStore)(nil)
@@ -0,0 +1,84 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "checkpoint.json")
+	store := NewFileStore(filename)
+
+	// nothing saved yet
+	cp, err := store.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cp, New()) {
+		t.Fatalf("got %+v, expected an empty checkpoint", cp)
+	}
+
+	for _, rv := range []string{"10", "11"} {
+		cp.ResourceVersion = rv
+		cp.Objects["a"] = rv
+		if err := store.Save(context.TODO(), cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a new process resumes from the last one
+	got, err := NewFileStore(filename).Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&Checkpoint{ResourceVersion: "11", Objects: map[string]string{"a": "11"}}); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+
+	// the temporary files have been renamed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "checkpoint.json" {
+		t.Fatalf("unexpected files %v", entries)
+	}
+}
+
+func TestFileStoreFailedRename(t *testing.T) {
+	dir := t.TempDir()
+
+	// the checkpoint cannot replace a non empty directory
+	filename := filepath.Join(dir, "checkpoint.json")
+	if err := os.MkdirAll(filepath.Join(filename, "keep"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewFileStore(filename).Save(context.TODO(), &Checkpoint{ResourceVersion: "10"}); err == nil {
+		t.Fatal("the checkpoint has been saved")
+	}
+
+	// the temporary file has been removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "checkpoint.json" {
+		t.Fatalf("unexpected files %v", entries)
+	}
+}
+
+func TestFileStoreCorrupted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(filename, []byte(`{"resourceVersion": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(filename).Load(context.TODO()); err == nil {
+		t.Fatal("a corrupted checkpoint has been loaded")
+	}
+}
@@ -0,0 +1,104 @@
+package checkpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Throttled is a `Store` saving at most once per interval: the
+// checkpoints saved in between replace each other and only the
+// latest one is written, when the interval expires.
+//
+// Saving on every event (i.e. a ConfigMap Get+Update) is costly:
+// on restart, a throttled checkpoint replays at most an interval of
+// events, which the consumers have to tolerate anyway.
+type Throttled struct {
+	store    Store
+	interval time.Duration
+
+	// serializes the saves
+	mu      sync.Mutex
+	pending *Checkpoint
+	last    time.Time
+	timer   *time.Timer
+	// of the last save
+	err error
+}
+
+// Throttle returns a `Store` saving the checkpoints in the specified
+// one at most once per interval; remember to Flush it before exiting.
+func Throttle(store Store, interval time.Duration) *Throttled {
+	return &Throttled{store: store, interval: interval}
+}
+
+// Load reads the checkpoint from the underlying store.
+func (t *Throttled) Load(ctx context.Context) (*Checkpoint, error) {
+	return t.store.Load(ctx)
+}
+
+// Save saves a copy of the checkpoint at once if the interval since the
+// last save expired, otherwise later (in the background).  The error of
+// a failed background save is returned until a save succeeds.
+func (t *Throttled) Save(ctx context.Context, cp *Checkpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the caller keeps changing its checkpoint
+	t.pending = cp.DeepCopy()
+
+	if time.Since(t.last) >= t.interval {
+		t.stopTimer()
+		return t.save(ctx)
+	}
+
+	if t.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(t.interval-time.Since(t.last), func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			// stopped too late: superseded by a save
+			if t.timer != timer {
+				return
+			}
+			t.timer = nil
+			t.save(context.Background())
+		})
+		t.timer = timer
+	}
+
+	return t.err
+}
+
+// Flush saves at once the checkpoint not saved yet (if any).
+func (t *Throttled) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopTimer()
+	if t.pending == nil {
+		return nil
+	}
+	return t.save(ctx)
+}
+
+// save writes the pending checkpoint, which is kept if it fails.
+func (t *Throttled) save(ctx context.Context) error {
+	t.err = t.store.Save(ctx, t.pending)
+	t.last = time.Now()
+	if t.err == nil {
+		t.pending = nil
+	}
+	return t.err
+}
+
+// stopTimer cancels the background save.
+func (t *Throttled) stopTimer() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+var _ Store = (*Throttled)(nil)
@@ -0,0 +1,136 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore remembers every saved resourceVersion
+type memoryStore struct {
+	mu    sync.Mutex
+	saved []string
+	err   error
+}
+
+func (m *memoryStore) Load(context.Context) (*Checkpoint, error) {
+	return New(), nil
+}
+
+func (m *memoryStore) Save(_ context.Context, cp *Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.saved = append(m.saved, cp.ResourceVersion)
+	return nil
+}
+
+func (m *memoryStore) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *memoryStore) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.saved...)
+}
+
+// waitSaved waits for the store to contain the expected resourceVersions
+func waitSaved(t *testing.T, m *memoryStore, expected ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(m.list(), expected) {
+		if time.Now().After(deadline) {
+			t.Fatalf("saved %v, expected %v", m.list(), expected)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	m := &memoryStore{}
+	store := Throttle(m, 100*time.Millisecond)
+
+	cp := New()
+	for _, rv := range []string{"1", "2", "3"} {
+		cp.ResourceVersion = rv
+		if err := store.Save(context.TODO(), cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// changed after the save: not seen by the store
+	cp.ResourceVersion = "4"
+
+	// the first one at once, the last one after the interval
+	if got := m.list(); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("saved %v, expected [1]", got)
+	}
+	waitSaved(t, m, "1", "3")
+
+	// nothing else to save
+	time.Sleep(200 * time.Millisecond)
+	if err := store.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	waitSaved(t, m, "1", "3")
+}
+
+func TestThrottleFlush(t *testing.T) {
+	m := &memoryStore{}
+	store := Throttle(m, time.Hour)
+
+	for _, rv := range []string{"1", "2", "3"} {
+		if err := store.Save(context.TODO(), &Checkpoint{ResourceVersion: rv}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	waitSaved(t, m, "1", "3")
+
+	// nothing pending anymore
+	if err := store.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	waitSaved(t, m, "1", "3")
+}
+
+func TestThrottleErrors(t *testing.T) {
+	boom := errors.New("boom")
+
+	m := &memoryStore{}
+	store := Throttle(m, 50*time.Millisecond)
+
+	if err := store.Save(context.TODO(), &Checkpoint{ResourceVersion: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the background save fails...
+	m.fail(boom)
+	if err := store.Save(context.TODO(), &Checkpoint{ResourceVersion: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// ...and is reported by the next call
+	if err := store.Save(context.TODO(), &Checkpoint{ResourceVersion: "3"}); !errors.Is(err, boom) {
+		t.Fatalf("got %v, expected %v", err, boom)
+	}
+
+	// the checkpoint is still pending
+	m.fail(nil)
+	if err := store.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	waitSaved(t, m, "1", "3")
+}
@@ -0,0 +1,282 @@
+// Package controller is a small framework to write controllers, extracted
+// from the workqueue example: the informers enqueue the keys of the
+// changed objects and the workers call the Reconciler for each key,
+// retrying the failures with a rate limiter.
+//
+//	c := controller.New(reconciler, controller.Options{Name: "pods"})
+//	controller.Watch[*corev1.Pod](c, podsInformer)
+//	c.Run(ctx, 2)
+//
+// The Reconciler reads the objects from the informer cache, for
+// example using a Lister, and makes the world match them.
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lucasepe/using-client-go/pkg/handler"
+)
+
+// Result tells the controller what to do after a successful reconcile.
+type Result struct {
+	// Requeue processes the key again (rate limited).
+	Requeue bool
+	// RequeueAfter processes the key again after the specified
+	// duration (i.e. to check an expiration); it wins over Requeue.
+	RequeueAfter time.Duration
+}
+
+// Reconciler makes the world match the object with the specified key.
+//
+// The object could have been deleted: it is up to the Reconciler to
+// check (and to clean up).  Errors are retried with a rate limiter.
+type Reconciler interface {
+	Reconcile(ctx context.Context, key Key) (Result, error)
+}
+
+// ReconcilerFunc is a function implementing Reconciler.
+type ReconcilerFunc func(ctx context.Context, key Key) (Result, error)
+
+// Reconcile calls the function.
+func (fn ReconcilerFunc) Reconcile(ctx context.Context, key Key) (Result, error) {
+	return fn(ctx, key)
+}
+
+// Options holds the Controller settings.
+type Options struct {
+	// Name identifies the controller (and its queue) in logs
+	// and in the workqueue metrics.
+	Name string
+	// MaxRetries is how many times a failing key is retried before
+	// being dropped (default 5).
+	MaxRetries int
+	// RateLimiter delays the retries
+	// (default workqueue.DefaultControllerRateLimiter).
+	RateLimiter workqueue.RateLimiter
+	// DrainTimeout is how long, once the context is done, the
+	// in-flight keys are given to complete (default 30s).
+	DrainTimeout time.Duration
+	// OnDrop is called with the keys dropped after MaxRetries
+	// (i.e. to record them in a dead-letter store).
+	OnDrop func(ctx context.Context, key Key, retries int, err error)
+}
+
+// ErrDrainTimeout is returned by Run when the keys
+// being processed did not complete within the DrainTimeout.
+var ErrDrainTimeout = errors.New("timed out draining the queue")
+
+// Controller processes the enqueued keys calling the Reconciler.
+type Controller struct {
+	name         string
+	reconciler   Reconciler
+	queue        workqueue.RateLimitingInterface
+	maxRetries   int
+	drainTimeout time.Duration
+	onDrop       func(ctx context.Context, key Key, retries int, err error)
+	synced       []cache.InformerSynced
+}
+
+// New returns a new `Controller`; add the informers with Watch, then Run it.
+func New(reconciler Reconciler, opts Options) *Controller {
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = workqueue.DefaultControllerRateLimiter()
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 30 * time.Second
+	}
+
+	return &Controller{
+		name:         opts.Name,
+		reconciler:   reconciler,
+		queue:        workqueue.NewNamedRateLimitingQueue(opts.RateLimiter, opts.Name),
+		maxRetries:   opts.MaxRetries,
+		drainTimeout: opts.DrainTimeout,
+		onDrop:       opts.OnDrop,
+	}
+}
+
+// Watch adds to the controller an informer of objects of type T:
+// the keys of the added, updated and deleted objects are enqueued and
+// the controller waits for the informer to be synced before starting.
+func Watch[T any](c *Controller, informer cache.SharedInformer) {
+	c.synced = append(c.synced, informer.HasSynced)
+
+	informer.AddEventHandler(handler.Funcs[T]{
+		AddFunc:    func(obj T) { c.enqueueObject(obj) },
+		UpdateFunc: func(_, obj T) { c.enqueueObject(obj) },
+		DeleteFunc: func(obj T) { c.enqueueObject(obj) },
+	})
+}
+
+// HasSynced tells if all the informers have synced.
+func (c *Controller) HasSynced() bool {
+	for _, fn := range c.synced {
+		if !fn() {
+			return false
+		}
+	}
+	return true
+}
+
+// Enqueue adds a key to the queue.
+func (c *Controller) Enqueue(key Key) {
+	c.queue.Add(key)
+}
+
+// EnqueueAfter adds a key to the queue after the specified duration.
+func (c *Controller) EnqueueAfter(key Key, d time.Duration) {
+	c.queue.AddAfter(key, d)
+}
+
+// enqueueObject adds the key of the object to the queue.
+func (c *Controller) enqueueObject(obj interface{}) {
+	key, err := KeyFor(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.Enqueue(key)
+}
+
+// Run waits for the informers to be synced and then processes the
+// keys with the specified number of workers, until the context is done.
+//
+// Then the queue is drained: no new keys are accepted and the keys
+// being processed are given DrainTimeout to complete (the Reconciler
+// context is canceled only after that), otherwise ErrDrainTimeout
+// is returned.  If the context is done before the informers have
+// synced, nothing was processed and ctx.Err() is returned.
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	// eventually catches a crash and logs an error
+	defer utilruntime.HandleCrash()
+
+	// let the workers stop when we are done
+	defer c.queue.ShutDown()
+
+	klog.InfoS("Starting controller", "controller", c.name)
+
+	// wait for all involved caches to be synced, before
+	// processing items from the queue is started
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+		if err := ctx.Err(); err != nil {
+			// shut down during the startup (i.e. CTRL+C)
+			return err
+		}
+		return fmt.Errorf("%s: timed out waiting for caches to sync", c.name)
+	}
+
+	// the workers outlive ctx, to complete the in-flight keys
+	workCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(workCtx, c.runWorker, time.Second)
+		}()
+	}
+
+	<-ctx.Done()
+	klog.InfoS("Stopping controller, draining the queue", "controller", c.name, "timeout", c.drainTimeout)
+
+	drained := make(chan struct{})
+	go func() {
+		// waits for the keys being processed, then shuts down the
+		// queue: the workers return (wait.Until does not restart them)
+		c.queue.ShutDownWithDrain()
+		stopWorkers()
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		klog.InfoS("Controller stopped", "controller", c.name)
+		return nil
+	case <-time.After(c.drainTimeout):
+		return fmt.Errorf("%s: %w after %v", c.name, ErrDrainTimeout, c.drainTimeout)
+	}
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	// wait until there is a new item in the working queue
+	item, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	// tell the queue that we are done with processing this key:
+	// two workers never process the same key in parallel
+	defer c.queue.Done(item)
+
+	key, ok := item.(Key)
+	if !ok {
+		// only Keys are enqueued: this should never happen
+		c.queue.Forget(item)
+		utilruntime.HandleError(fmt.Errorf("%s: unexpected item of type %T in the queue", c.name, item))
+		return true
+	}
+
+	res, err := c.reconciler.Reconcile(ctx, key)
+	c.handleResult(ctx, key, res, err)
+
+	return true
+}
+
+// handleResult requeues the key if needed: on success as requested
+// by the result, on failure (rate limited) until MaxRetries is reached.
+func (c *Controller) handleResult(ctx context.Context, key Key, res Result, err error) {
+	if err == nil {
+		// forget about the #AddRateLimited history of the key
+		c.queue.Forget(key)
+
+		switch {
+		case res.RequeueAfter > 0:
+			c.queue.AddAfter(key, res.RequeueAfter)
+		case res.Requeue:
+			c.queue.AddRateLimited(key)
+		}
+		return
+	}
+
+	retries := c.queue.NumRequeues(key)
+	if retries < c.maxRetries {
+		klog.InfoS("Error reconciling, retrying", "controller", c.name, "key", key, "err", err)
+
+		// re-enqueue the key rate limited: based on the rate limiter
+		// and the re-enqueue history, the key will be processed later
+		c.queue.AddRateLimited(key)
+		return
+	}
+
+	c.queue.Forget(key)
+
+	// report that, even after several retries,
+	// we could not successfully process this key
+	utilruntime.HandleError(err)
+
+	klog.InfoS("Dropping key out of the queue", "controller", c.name, "key", key, "err", err)
+
+	if c.onDrop != nil {
+		c.onDrop(ctx, key, retries, err)
+	}
+}
@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var nginx = Key{Namespace: "default", Name: "nginx"}
+
+// calls records the keys reconciled, with the time of each call
+type calls struct {
+	mu    sync.Mutex
+	keys  []Key
+	times []time.Time
+}
+
+func (c *calls) add(key Key) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys = append(c.keys, key)
+	c.times = append(c.times, time.Now())
+	return len(c.keys)
+}
+
+func (c *calls) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keys)
+}
+
+func (c *calls) at(i int) (Key, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[i], c.times[i]
+}
+
+// fastRetries makes the rate limited retries almost immediate
+func fastRetries() workqueue.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)
+}
+
+// start runs the controller, watching the pods served by a fake
+// clientset (the nginx one), until the returned function is called;
+// the function returns the error returned by Run
+func start(t *testing.T, r Reconciler, opts Options) func() error {
+	t.Helper()
+
+	cs := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nginx.Namespace, Name: nginx.Name},
+	})
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	informer := factory.Core().V1().Pods().Informer()
+
+	c := New(r, opts)
+	Watch[*corev1.Pod](c, informer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	factory.Start(ctx.Done())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, 1)
+	}()
+
+	var once sync.Once
+	var err error
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			select {
+			case err = <-errCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return")
+			}
+		})
+		return err
+	}
+	t.Cleanup(func() { stop() })
+
+	return stop
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReconcileTheWatchedObjects(t *testing.T) {
+	c := &calls{}
+	stop := start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		c.add(key)
+		return Result{}, nil
+	}), Options{Name: "test"})
+
+	waitFor(t, "the reconcile", func() bool { return c.count() == 1 })
+
+	// nothing is requeued
+	time.Sleep(50 * time.Millisecond)
+	if got := c.count(); got != 1 {
+		t.Fatalf("got %d reconciles, expected 1", got)
+	}
+	if key, _ := c.at(0); key != nginx {
+		t.Fatalf("got key %v, expected %v", key, nginx)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	c := &calls{}
+	start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		// requeued once
+		return Result{Requeue: c.add(key) == 1}, nil
+	}), Options{Name: "test", RateLimiter: fastRetries()})
+
+	waitFor(t, "the requeued key", func() bool { return c.count() == 2 })
+
+	time.Sleep(50 * time.Millisecond)
+	if got := c.count(); got != 2 {
+		t.Fatalf("got %d reconciles, expected 2", got)
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	const after = 100 * time.Millisecond
+
+	c := &calls{}
+	start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		if c.add(key) == 1 {
+			// wins over Requeue
+			return Result{Requeue: true, RequeueAfter: after}, nil
+		}
+		return Result{}, nil
+	}), Options{Name: "test", RateLimiter: fastRetries()})
+
+	waitFor(t, "the requeued key", func() bool { return c.count() == 2 })
+
+	_, first := c.at(0)
+	key, second := c.at(1)
+	if key != nginx {
+		t.Fatalf("got key %v, expected %v", key, nginx)
+	}
+	if elapsed := second.Sub(first); elapsed < after {
+		t.Fatalf("requeued after %s, expected at least %s", elapsed, after)
+	}
+}
+
+func TestMaxRetriesDrops(t *testing.T) {
+	boom := errors.New("boom")
+
+	type drop struct {
+		key     Key
+		retries int
+		err     error
+	}
+	dropped := make(chan drop, 1)
+
+	c := &calls{}
+	start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		c.add(key)
+		return Result{}, boom
+	}), Options{
+		Name:        "test",
+		MaxRetries:  3,
+		RateLimiter: fastRetries(),
+		OnDrop: func(ctx context.Context, key Key, retries int, err error) {
+			dropped <- drop{key, retries, err}
+		},
+	})
+
+	select {
+	case got := <-dropped:
+		if got.key != nginx || got.retries != 3 || !errors.Is(got.err, boom) {
+			t.Fatalf("unexpected drop %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the key was not dropped")
+	}
+
+	// the first attempt, then MaxRetries retries
+	time.Sleep(50 * time.Millisecond)
+	if got := c.count(); got != 4 {
+		t.Fatalf("got %d reconciles, expected 4", got)
+	}
+}
+
+func TestDrainCompletesTheInFlightKeys(t *testing.T) {
+	started := make(chan struct{})
+	var canceled bool
+
+	stop := start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		close(started)
+		// still in flight when the shutdown begins
+		time.Sleep(100 * time.Millisecond)
+		canceled = ctx.Err() != nil
+		return Result{}, nil
+	}), Options{Name: "test", DrainTimeout: 5 * time.Second})
+
+	<-started
+	if err := stop(); err != nil {
+		t.Fatalf("expected a clean drain, got: %v", err)
+	}
+	if canceled {
+		t.Fatal("the Reconciler context was canceled while draining")
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	stop := start(t, ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		close(started)
+		<-release
+		return Result{}, nil
+	}), Options{Name: "test", DrainTimeout: 50 * time.Millisecond})
+
+	<-started
+
+	begin := time.Now()
+	err := stop()
+	if !errors.Is(err, ErrDrainTimeout) {
+		t.Fatalf("got %v, expected ErrDrainTimeout", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 50*time.Millisecond {
+		t.Fatalf("gave up after %s, before the DrainTimeout", elapsed)
+	}
+}
+
+func TestRunCanceledBeforeSync(t *testing.T) {
+	c := New(ReconcilerFunc(func(ctx context.Context, key Key) (Result, error) {
+		t.Errorf("unexpected reconcile of %v", key)
+		return Result{}, nil
+	}), Options{Name: "test"})
+
+	// an informer never synced
+	c.synced = append(c.synced, func() bool { return false })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Run(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, expected context.Canceled", err)
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// Key identifies an object in the queue; the namespace
+// is empty for the cluster scoped objects.
+type Key struct {
+	Namespace string
+	Name      string
+}
+
+// String returns the namespace/name key (just the name for
+// cluster scoped objects), as used by the informer caches.
+func (k Key) String() string {
+	if len(k.Namespace) == 0 {
+		return k.Name
+	}
+	return k.Namespace + "/" + k.Name
+}
+
+// KeyFor returns the key of an object (or of a tombstone).
+func KeyFor(obj interface{}) (Key, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return ParseKey(tombstone.Key)
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return Key{}, err
+	}
+	return ParseKey(key)
+}
+
+// ParseKey returns the Key of a namespace/name (or name) string.
+func ParseKey(key string) (Key, error) {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Namespace: ns, Name: name}, nil
+}
+
+// Lister reads the objects of type T from an informer cache.
+type Lister[T any] struct {
+	store cache.Store
+}
+
+// NewLister returns a `Lister` reading from the informer cache.
+func NewLister[T any](informer cache.SharedInformer) Lister[T] {
+	return Lister[T]{store: informer.GetStore()}
+}
+
+// Get returns the object with the key; found is false if the
+// object does not exist (anymore).
+func (l Lister[T]) Get(key Key) (obj T, found bool, err error) {
+	item, exists, err := l.store.GetByKey(key.String())
+	if err != nil || !exists {
+		return obj, false, err
+	}
+
+	obj, ok := item.(T)
+	if !ok {
+		return obj, false, fmt.Errorf("unexpected object of type %T, expecting %T", item, obj)
+	}
+
+	return obj, true, nil
+}
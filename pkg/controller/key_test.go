@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		obj      interface{}
+		expected Key
+		str      string
+	}{
+		"namespaced": {
+			obj:      &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"}},
+			expected: Key{Namespace: "default", Name: "nginx"},
+			str:      "default/nginx",
+		},
+		"cluster scoped": {
+			obj:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+			expected: Key{Name: "demo"},
+			str:      "demo",
+		},
+		"tombstone": {
+			obj:      cache.DeletedFinalStateUnknown{Key: "default/nginx"},
+			expected: Key{Namespace: "default", Name: "nginx"},
+			str:      "default/nginx",
+		},
+	}
+
+	for name, tc := range tests {
+		key, err := KeyFor(tc.obj)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if key != tc.expected {
+			t.Fatalf("%s: got %+v, expected %+v", name, key, tc.expected)
+		}
+		if got := key.String(); got != tc.str {
+			t.Fatalf("%s: got %q, expected %q", name, got, tc.str)
+		}
+
+		parsed, err := ParseKey(key.String())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if parsed != key {
+			t.Fatalf("%s: got %+v back, expected %+v", name, parsed, key)
+		}
+	}
+}
+
+func TestKeyErrors(t *testing.T) {
+	if _, err := ParseKey("a/b/c"); err == nil {
+		t.Fatal("expected an error for a/b/c")
+	}
+	if _, err := KeyFor("not an object"); err == nil {
+		t.Fatal("expected an error for a string")
+	}
+}
+
+func TestLister(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+	})
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	informer := factory.Core().V1().Pods().Informer()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("failed to sync")
+	}
+
+	pod, found, err := NewLister[*corev1.Pod](informer).Get(Key{Namespace: "default", Name: "nginx"})
+	if err != nil || !found || pod.Name != "nginx" {
+		t.Fatalf("got %v, %v, %v, expected the nginx pod", pod, found, err)
+	}
+
+	if _, found, err := NewLister[*corev1.Pod](informer).Get(Key{Namespace: "default", Name: "gone"}); err != nil || found {
+		t.Fatalf("got %v, %v, expected not found", found, err)
+	}
+
+	// the cache holds pods
+	if _, _, err := NewLister[*corev1.Namespace](informer).Get(Key{Namespace: "default", Name: "nginx"}); err == nil {
+		t.Fatal("expected an error reading pods as namespaces")
+	}
+}
@@ -0,0 +1,95 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// configMapKey is the ConfigMap data key holding the entries.
+const configMapKey = "deadletters.json"
+
+// ConfigMapPersister saves the entries in a ConfigMap (which cannot
+// be larger than 1MiB: keep the Store MaxEntries reasonable).
+type ConfigMapPersister struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapPersister returns a `Persister` using the
+// ConfigMap with the specified namespace and name.
+func NewConfigMapPersister(cs kubernetes.Interface, namespace, name string) *ConfigMapPersister {
+	return &ConfigMapPersister{
+		client:    cs,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load reads the entries from the ConfigMap.
+func (p *ConfigMapPersister) Load(ctx context.Context) ([]Entry, error) {
+	cm, err := p.client.CoreV1().ConfigMaps(p.namespace).
+		Get(ctx, p.name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	data, ok := cm.Data[configMapKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var res []Entry
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Save writes the entries in the ConfigMap, creating it if needed.
+func (p *ConfigMapPersister) Save(ctx context.Context, entries []Entry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	cmc := p.client.CoreV1().ConfigMaps(p.namespace)
+
+	// the ConfigMap could be changed meanwhile (i.e. by kubectl)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := cmc.Get(ctx, p.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = cmc.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      p.name,
+					Namespace: p.namespace,
+				},
+				Data: map[string]string{configMapKey: string(data)},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[configMapKey] = string(data)
+
+		_, err = cmc.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+var _ Persister = (*ConfigMapPersister)(nil)
@@ -0,0 +1,220 @@
+// Package deadletter keeps the keys a controller gave up on (dropped
+// after the max retries), so an operator can inspect and re-enqueue
+// them once the cause has been fixed.
+//
+// The entries are kept in memory and, optionally, persisted (i.e. in
+// a ConfigMap) to survive the restarts.
+package deadletter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is how many entries a Store keeps by default:
+// the oldest ones are evicted first.
+const DefaultMaxEntries = 1000
+
+// Entry is a dropped key.
+type Entry struct {
+	// Key is the namespace/name of the object.
+	Key string `json:"key"`
+	// Error is the last reconcile error.
+	Error string `json:"error"`
+	// Retries is how many times the key has been retried.
+	Retries int `json:"retries"`
+	// DroppedAt is when the key has been dropped.
+	DroppedAt time.Time `json:"droppedAt"`
+}
+
+// Persister knows how to load and save the entries.
+type Persister interface {
+	// Load returns the saved entries (none if nothing has been saved yet).
+	Load(ctx context.Context) ([]Entry, error)
+
+	// Save persists the specified entries.
+	Save(ctx context.Context, entries []Entry) error
+}
+
+// Store holds the dead letters, one for each key.
+type Store struct {
+	// MaxEntries caps the number of entries (default DefaultMaxEntries).
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]Entry
+	// incremented at every change
+	version uint64
+
+	persister Persister
+	// serializes the saves, done without holding mu
+	saveMu sync.Mutex
+	// the version of the last saved entries
+	saved uint64
+}
+
+// NewStore returns an in memory `Store`.
+func NewStore() *Store {
+	return &Store{
+		MaxEntries: DefaultMaxEntries,
+		entries:    map[string]Entry{},
+	}
+}
+
+// NewPersistentStore returns a `Store` loading the entries from the
+// persister and saving them there at every change.
+func NewPersistentStore(ctx context.Context, persister Persister) (*Store, error) {
+	entries, err := persister.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewStore()
+	s.persister = persister
+	for _, el := range entries {
+		s.entries[el.Key] = el
+	}
+
+	return s, nil
+}
+
+// Add records a dropped key (replacing a previous entry for the same
+// key); the entry is kept in memory even if it cannot be persisted.
+func (s *Store) Add(ctx context.Context, entry Entry) error {
+	s.mu.Lock()
+
+	if entry.DroppedAt.IsZero() {
+		entry.DroppedAt = time.Now()
+	}
+	s.entries[entry.Key] = entry
+
+	// evict the oldest entries
+	if max := s.maxEntries(); len(s.entries) > max {
+		all := s.sorted()
+		for _, el := range all[:len(all)-max] {
+			delete(s.entries, el.Key)
+		}
+	}
+
+	s.version++
+	version := s.version
+	s.mu.Unlock()
+
+	return s.save(ctx, version)
+}
+
+// Remove deletes the entry of the key, returning it.
+func (s *Store) Remove(ctx context.Context, key string) (Entry, bool, error) {
+	s.mu.Lock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		s.mu.Unlock()
+		return entry, false, nil
+	}
+	delete(s.entries, key)
+
+	s.version++
+	version := s.version
+	s.mu.Unlock()
+
+	return entry, true, s.save(ctx, version)
+}
+
+// Get returns the entry of the key.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	return entry, ok
+}
+
+// removeEntry deletes the entry unless it has been replaced
+// meanwhile (i.e. the key has been dropped again).
+func (s *Store) removeEntry(ctx context.Context, entry Entry) error {
+	s.mu.Lock()
+
+	if el, ok := s.entries[entry.Key]; !ok || !el.DroppedAt.Equal(entry.DroppedAt) {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.entries, entry.Key)
+
+	s.version++
+	version := s.version
+	s.mu.Unlock()
+
+	return s.save(ctx, version)
+}
+
+// List returns the entries, the oldest first.
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sorted()
+}
+
+// Len returns the number of entries.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+func (s *Store) maxEntries() int {
+	if s.MaxEntries <= 0 {
+		return DefaultMaxEntries
+	}
+	return s.MaxEntries
+}
+
+// sorted returns the entries by drop time (the caller holds the lock)
+func (s *Store) sorted() []Entry {
+	res := make([]Entry, 0, len(s.entries))
+	for _, el := range s.entries {
+		res = append(res, el)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].DroppedAt.Equal(res[j].DroppedAt) {
+			return res[i].Key < res[j].Key
+		}
+		return res[i].DroppedAt.Before(res[j].DroppedAt)
+	})
+
+	return res
+}
+
+// save persists the entries, if there is a persister, without holding
+// the lock (a slow persister does not block the readers); the latest
+// entries are saved, so the changes waiting meanwhile are saved too
+// and never overwritten by an older version.
+func (s *Store) save(ctx context.Context, version uint64) error {
+	if s.persister == nil {
+		return nil
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	// already saved along with a later change
+	if version <= s.saved {
+		return nil
+	}
+
+	s.mu.Lock()
+	version, entries := s.version, s.sorted()
+	s.mu.Unlock()
+
+	if err := s.persister.Save(ctx, entries); err != nil {
+		return err
+	}
+	s.saved = version
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func keys(entries []Entry) []string {
+	res := make([]string, 0, len(entries))
+	for _, el := range entries {
+		res = append(res, el.Key)
+	}
+	return res
+}
+
+// add records the keys, dropped one second after the other
+func add(t *testing.T, s *Store, names ...string) {
+	t.Helper()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(s.Len()) * time.Second)
+	for i, el := range names {
+		if err := s.Add(context.TODO(), Entry{Key: el, DroppedAt: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoreEvictsTheOldestEntries(t *testing.T) {
+	s := NewStore()
+	s.MaxEntries = 3
+
+	add(t, s, "default/a", "default/b", "default/c", "default/d", "default/e")
+
+	if got := s.Len(); got != 3 {
+		t.Fatalf("got %d entries, expected 3", got)
+	}
+	if expected := []string{"default/c", "default/d", "default/e"}; !reflect.DeepEqual(keys(s.List()), expected) {
+		t.Fatalf("got %v, expected %v", keys(s.List()), expected)
+	}
+}
+
+func TestStoreReplacesTheEntryOfTheSameKey(t *testing.T) {
+	s := NewStore()
+	s.MaxEntries = 2
+
+	add(t, s, "default/a", "default/b")
+
+	// dropped again: the newest now
+	if err := s.Add(context.TODO(), Entry{Key: "default/a", Retries: 7}); err != nil {
+		t.Fatal(err)
+	}
+	add(t, s, "default/c")
+
+	if expected := []string{"default/c", "default/a"}; !reflect.DeepEqual(keys(s.List()), expected) {
+		t.Fatalf("got %v, expected %v", keys(s.List()), expected)
+	}
+	if el, _ := s.Get("default/a"); el.Retries != 7 || el.DroppedAt.IsZero() {
+		t.Fatalf("unexpected entry %+v", el)
+	}
+}
+
+func TestStoreDefaultMaxEntries(t *testing.T) {
+	s := &Store{entries: map[string]Entry{}}
+
+	for i := 0; i < DefaultMaxEntries+10; i++ {
+		add(t, s, fmt.Sprintf("default/pod-%d", i))
+	}
+
+	if got := s.Len(); got != DefaultMaxEntries {
+		t.Fatalf("got %d entries, expected %d", got, DefaultMaxEntries)
+	}
+}
+
+func TestStoreRemove(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a")
+
+	if _, found, err := s.Remove(context.TODO(), "default/b"); found || err != nil {
+		t.Fatalf("got %t %v, expected not found", found, err)
+	}
+
+	el, found, err := s.Remove(context.TODO(), "default/a")
+	if !found || err != nil || el.Key != "default/a" {
+		t.Fatalf("got %+v %t %v, expected the removed entry", el, found, err)
+	}
+	if got := s.Len(); got != 0 {
+		t.Fatalf("got %d entries, expected none", got)
+	}
+}
+
+// failingPersister cannot save anything
+type failingPersister struct{}
+
+func (failingPersister) Load(context.Context) ([]Entry, error) { return nil, nil }
+
+func (failingPersister) Save(context.Context, []Entry) error { return errors.New("boom") }
+
+func TestStoreKeepsTheEntriesWhenNotPersisted(t *testing.T) {
+	s, err := NewPersistentStore(context.TODO(), failingPersister{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Add(context.TODO(), Entry{Key: "default/a"}); err == nil {
+		t.Fatal("expected the persister error")
+	}
+	if got := s.Len(); got != 1 {
+		t.Fatalf("got %d entries, expected 1", got)
+	}
+}
+
+func TestConfigMapPersister(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	s, err := NewPersistentStore(context.TODO(), NewConfigMapPersister(cs, "default", "deadletters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxEntries = 2
+
+	add(t, s, "default/a", "default/b", "default/c")
+
+	// a restart: the entries are loaded back
+	s, err = NewPersistentStore(context.TODO(), NewConfigMapPersister(cs, "default", "deadletters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"default/b", "default/c"}; !reflect.DeepEqual(keys(s.List()), expected) {
+		t.Fatalf("got %v, expected %v", keys(s.List()), expected)
+	}
+}
+
+// blockingPersister records the saved entries, once released
+type blockingPersister struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	saved [][]Entry
+}
+
+func newBlockingPersister() *blockingPersister {
+	return &blockingPersister{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (p *blockingPersister) Load(context.Context) ([]Entry, error) { return nil, nil }
+
+func (p *blockingPersister) Save(_ context.Context, entries []Entry) error {
+	p.started <- struct{}{}
+	<-p.release
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saved = append(p.saved, entries)
+	return nil
+}
+
+func (p *blockingPersister) saves() [][]Entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]Entry(nil), p.saved...)
+}
+
+func TestStoreSavesWithoutBlockingTheReaders(t *testing.T) {
+	p := newBlockingPersister()
+	s, err := NewPersistentStore(context.TODO(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 3)
+	go func() { done <- s.Add(context.TODO(), Entry{Key: "default/a"}) }()
+	<-p.started
+
+	// the save is in progress
+	if _, ok := s.Get("default/a"); !ok || s.Len() != 1 || len(s.List()) != 1 {
+		t.Fatal("the entry is not there while being saved")
+	}
+
+	// changed meanwhile: waiting for the first save
+	go func() { done <- s.Add(context.TODO(), Entry{Key: "default/b"}) }()
+	go func() { done <- s.Add(context.TODO(), Entry{Key: "default/c"}) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Len() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(p.release)
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the latest entries have been saved last (the waiting changes together)
+	saves := p.saves()
+	if len(saves) != 2 {
+		t.Fatalf("got %d saves, expected 2", len(saves))
+	}
+	if got, expected := keys(saves[1]), keys(s.List()); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("saved %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Result is the outcome of the re-enqueue of a key.
+type Result struct {
+	// Key is the namespace/name of the object.
+	Key string `json:"key"`
+	// Requeued is true if the key has been re-enqueued.
+	Requeued bool `json:"requeued"`
+	// Error tells why the key has not been re-enqueued or,
+	// if it has, why it has not been removed from the persister.
+	Error string `json:"error,omitempty"`
+}
+
+// Handler serves the dead letters:
+//
+//	GET  /deadletters                  lists the entries (JSON)
+//	POST /deadletters?key=<ns>/<name>  re-enqueues the key
+//	POST /deadletters?all              re-enqueues all the keys
+//
+// The re-enqueued keys are removed from the store (they come back
+// if they fail again); the keys that cannot be re-enqueued are kept.
+// POST answers with the Result of each key: the status is 200 if all
+// the keys have been re-enqueued, otherwise that of the first failure
+// (404 for an unknown key, 400 if the requeue failed).
+func Handler(store *Store, requeue func(key string) error) http.Handler {
+	return http.HandlerFunc(func(wri http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			wri.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(wri).Encode(store.List())
+
+		case http.MethodPost:
+			var keys []string
+			if _, all := req.URL.Query()["all"]; all {
+				for _, el := range store.List() {
+					keys = append(keys, el.Key)
+				}
+			} else if key := req.URL.Query().Get("key"); len(key) > 0 {
+				keys = append(keys, key)
+			} else {
+				http.Error(wri, "missing key (or all) parameter", http.StatusBadRequest)
+				return
+			}
+
+			status := http.StatusOK
+			fail := func(code int) {
+				if status == http.StatusOK {
+					status = code
+				}
+			}
+
+			results := make([]Result, 0, len(keys))
+			for _, key := range keys {
+				res := Result{Key: key}
+
+				entry, found := store.Get(key)
+				if !found {
+					res.Error = fmt.Sprintf("key %q not found", key)
+					results = append(results, res)
+					fail(http.StatusNotFound)
+					continue
+				}
+
+				if err := requeue(key); err != nil {
+					res.Error = err.Error()
+					results = append(results, res)
+					fail(http.StatusBadRequest)
+					continue
+				}
+				res.Requeued = true
+
+				// removed from memory even if the persister fails
+				if err := store.removeEntry(req.Context(), entry); err != nil {
+					res.Error = fmt.Sprintf("not persisted: %v", err)
+				}
+				results = append(results, res)
+			}
+
+			wri.Header().Set("Content-Type", "application/json")
+			wri.WriteHeader(status)
+			json.NewEncoder(wri).Encode(results)
+
+		default:
+			wri.Header().Set("Allow", "GET, POST")
+			http.Error(wri, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
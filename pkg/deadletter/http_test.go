@@ -0,0 +1,194 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// requeuer records the re-enqueued keys, failing the specified ones
+type requeuer struct {
+	failing map[string]bool
+	keys    []string
+}
+
+func (r *requeuer) requeue(key string) error {
+	if r.failing[key] {
+		return errors.New("invalid key")
+	}
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func post(t *testing.T, h http.Handler, query string) (int, []Result) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deadletters?"+query, nil))
+
+	var res []Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s: %v", rec.Body, err)
+	}
+
+	return rec.Code, res
+}
+
+func TestHandlerList(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a", "default/b")
+
+	rec := httptest.NewRecorder()
+	Handler(s, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deadletters", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, expected 200", rec.Code)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"default/a", "default/b"}; !reflect.DeepEqual(keys(entries), expected) {
+		t.Fatalf("got %v, expected %v", keys(entries), expected)
+	}
+}
+
+func TestHandlerRequeueKey(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a", "default/b")
+
+	r := &requeuer{}
+	code, res := post(t, Handler(s, r.requeue), "key=default/a")
+
+	if code != http.StatusOK {
+		t.Fatalf("got %d, expected 200", code)
+	}
+	if expected := []Result{{Key: "default/a", Requeued: true}}; !reflect.DeepEqual(res, expected) {
+		t.Fatalf("got %+v, expected %+v", res, expected)
+	}
+	if expected := []string{"default/a"}; !reflect.DeepEqual(r.keys, expected) {
+		t.Fatalf("re-enqueued %v, expected %v", r.keys, expected)
+	}
+	if expected := []string{"default/b"}; !reflect.DeepEqual(keys(s.List()), expected) {
+		t.Fatalf("left %v, expected %v", keys(s.List()), expected)
+	}
+}
+
+func TestHandlerUnknownKey(t *testing.T) {
+	r := &requeuer{}
+	code, res := post(t, Handler(NewStore(), r.requeue), "key=default/a")
+
+	if code != http.StatusNotFound {
+		t.Fatalf("got %d, expected 404", code)
+	}
+	if len(res) != 1 || res[0].Requeued || len(res[0].Error) == 0 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if len(r.keys) != 0 {
+		t.Fatalf("unexpected re-enqueued keys %v", r.keys)
+	}
+}
+
+func TestHandlerKeepsTheKeyWhenRequeueFails(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a")
+
+	r := &requeuer{failing: map[string]bool{"default/a": true}}
+	code, res := post(t, Handler(s, r.requeue), "key=default/a")
+
+	if code != http.StatusBadRequest {
+		t.Fatalf("got %d, expected 400", code)
+	}
+	if expected := []Result{{Key: "default/a", Error: "invalid key"}}; !reflect.DeepEqual(res, expected) {
+		t.Fatalf("got %+v, expected %+v", res, expected)
+	}
+	// still there, to be retried later
+	if got := s.Len(); got != 1 {
+		t.Fatalf("got %d entries, expected 1", got)
+	}
+}
+
+func TestHandlerRequeueAll(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a", "default/b", "default/c")
+
+	// the failure in the middle does not stop the others
+	r := &requeuer{failing: map[string]bool{"default/b": true}}
+	code, res := post(t, Handler(s, r.requeue), "all")
+
+	if code != http.StatusBadRequest {
+		t.Fatalf("got %d, expected 400", code)
+	}
+
+	expected := []Result{
+		{Key: "default/a", Requeued: true},
+		{Key: "default/b", Error: "invalid key"},
+		{Key: "default/c", Requeued: true},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("got %+v, expected %+v", res, expected)
+	}
+	if expected := []string{"default/b"}; !reflect.DeepEqual(keys(s.List()), expected) {
+		t.Fatalf("left %v, expected %v", keys(s.List()), expected)
+	}
+}
+
+func TestHandlerRequeueNotPersisted(t *testing.T) {
+	s, err := NewPersistentStore(context.TODO(), failingPersister{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(context.TODO(), Entry{Key: "default/a"})
+
+	r := &requeuer{}
+	code, res := post(t, Handler(s, r.requeue), "key=default/a")
+
+	// re-enqueued anyway: the persister is only a backup
+	if code != http.StatusOK {
+		t.Fatalf("got %d, expected 200", code)
+	}
+	if len(res) != 1 || !res[0].Requeued || res[0].Error != "not persisted: boom" {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if got := s.Len(); got != 0 {
+		t.Fatalf("got %d entries, expected none", got)
+	}
+}
+
+func TestHandlerDroppedAgainIsKept(t *testing.T) {
+	s := NewStore()
+	add(t, s, "default/a")
+
+	// the key fails again while being re-enqueued
+	requeue := func(key string) error {
+		return s.Add(context.TODO(), Entry{Key: key, Retries: 5})
+	}
+
+	if code, _ := post(t, Handler(s, requeue), "key=default/a"); code != http.StatusOK {
+		t.Fatalf("got %d, expected 200", code)
+	}
+	if el, ok := s.Get("default/a"); !ok || el.Retries != 5 {
+		t.Fatalf("the new entry has been removed: %+v", el)
+	}
+}
+
+func TestHandlerBadRequests(t *testing.T) {
+	h := Handler(NewStore(), (&requeuer{}).requeue)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deadletters", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("no key: got %d, expected 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/deadletters", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST" {
+		t.Fatalf("DELETE: got %d, expected 405", rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// CloudEvent is an event in the CloudEvents (v1.0) JSON format.
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// FromWatchEvent converts a watch event in a CloudEvent.
+//
+// The event type is built from the object kind and the event type
+// (i.e. io.k8s.namespace.added); the id, made of the object UID
+// and resourceVersion, lets the receiver detect duplicates.
+func FromWatchEvent(source string, event watch.Event) (CloudEvent, error) {
+	acc, err := meta.Accessor(event.Object)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	kind := event.Object.GetObjectKind().GroupVersionKind().Kind
+	if len(kind) == 0 {
+		kind = "object"
+	}
+
+	subject := acc.GetName()
+	if ns := acc.GetNamespace(); len(ns) > 0 {
+		subject = fmt.Sprintf("%s/%s", ns, acc.GetName())
+	}
+
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event.Object)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              fmt.Sprintf("%s-%s", acc.GetUID(), acc.GetResourceVersion()),
+		Source:          source,
+		Type:            fmt.Sprintf("io.k8s.%s.%s", strings.ToLower(kind), strings.ToLower(string(event.Type))),
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
@@ -0,0 +1,276 @@
+// Package forwarder ships watch events to an external HTTP sink
+// as CloudEvents, in batches, with at-least-once semantics.
+//
+// Each event is enqueued together with an `ack` function; the acks
+// are called (in order) only once the batch holding the event has been
+// accepted by the sink or saved in the on-disk spool.  Saving the watch
+// checkpoint in the ack function makes sure that, after a restart, the
+// watch is resumed from the last event that has not been lost.
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// ContentTypeBatch is the content type of the CloudEvents batched mode.
+const ContentTypeBatch = "application/cloudevents-batch+json"
+
+// Options holds the Forwarder settings.
+type Options struct {
+	// SinkURL is where the batches are POSTed.
+	SinkURL string
+	// BatchSize is the maximum number of events in a batch.
+	BatchSize int
+	// FlushInterval is the maximum time an event waits for its batch to fill up.
+	FlushInterval time.Duration
+	// Backoff drives the retries of a failed batch, before it is spooled.
+	Backoff wait.Backoff
+	// Spool keeps the batches while the sink is down; nil disables spooling.
+	Spool *Spool
+	// Client is the HTTP client used to reach the sink.
+	Client *http.Client
+}
+
+// item is an enqueued event with its acknowledgement function.
+type item struct {
+	event CloudEvent
+	ack   func()
+}
+
+// Forwarder sends the enqueued events to the sink.
+type Forwarder struct {
+	opts  Options
+	queue chan item
+}
+
+// New returns a new `Forwarder`; call Run to start it.
+func New(opts Options) *Forwarder {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.Backoff.Steps <= 0 {
+		opts.Backoff = wait.Backoff{
+			Duration: 500 * time.Millisecond,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    5,
+		}
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Forwarder{
+		opts:  opts,
+		queue: make(chan item, opts.BatchSize),
+	}
+}
+
+// Enqueue adds an event to the next batch; it blocks when the forwarder
+// is lagging behind (back pressure).  The ack function (if not nil) is
+// called once the event has been delivered or spooled.
+func (f *Forwarder) Enqueue(ctx context.Context, event CloudEvent, ack func()) error {
+	select {
+	case f.queue <- item{event: event, ack: ack}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run collects the events in batches and sends them
+// until the context is done; the pending batch is flushed.
+func (f *Forwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]item, 0, f.opts.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			f.drainSpool(ctx)
+			return
+		}
+		f.flush(ctx, batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// last chance for the pending batch
+			last, cancel := context.WithTimeout(context.Background(), f.opts.FlushInterval)
+			f.flush(last, batch)
+			cancel()
+			return
+
+		case <-ticker.C:
+			flush()
+
+		case it := <-f.queue:
+			batch = append(batch, it)
+			if len(batch) >= f.opts.BatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// flush delivers a batch; when the sink keeps failing the batch is
+// spooled.  The events are acknowledged only when they are safe: if
+// neither the sink nor the spool accept them, the batch is retried
+// until the context is done (blocking the watchers, not losing events).
+func (f *Forwarder) flush(ctx context.Context, batch []item) {
+	if len(batch) == 0 {
+		return
+	}
+
+	events := make([]CloudEvent, 0, len(batch))
+	for _, el := range batch {
+		events = append(events, el.event)
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		klog.ErrorS(err, "Dropping batch that cannot be encoded", "events", len(events))
+		return
+	}
+
+	for {
+		err = f.deliver(ctx, data)
+		if err == nil || errors.Is(err, errPermanent) {
+			break
+		}
+
+		if f.opts.Spool != nil {
+			if err = f.opts.Spool.Put(data); err == nil {
+				klog.InfoS("Sink unavailable, batch spooled", "events", len(events))
+				break
+			}
+		}
+
+		klog.ErrorS(err, "Batch not delivered, retrying", "events", len(events))
+
+		select {
+		case <-ctx.Done():
+			// not acknowledged: the events will be replayed on restart
+			return
+		case <-time.After(f.opts.FlushInterval):
+		}
+	}
+
+	if errors.Is(err, errPermanent) {
+		klog.ErrorS(err, "Dropping batch rejected by the sink", "events", len(events))
+	}
+
+	for _, el := range batch {
+		if el.ack != nil {
+			el.ack()
+		}
+	}
+}
+
+// deliver sends the spooled batches (to preserve the order)
+// and then the specified one, retrying with backoff.
+func (f *Forwarder) deliver(ctx context.Context, data []byte) error {
+	if f.opts.Spool != nil && f.opts.Spool.Len() > 0 {
+		if err := f.opts.Spool.Drain(func(b []byte) error {
+			return dropPermanent(f.sendWithRetry(ctx, b))
+		}); err != nil {
+			return err
+		}
+	}
+
+	return f.sendWithRetry(ctx, data)
+}
+
+// drainSpool tries to send the spooled batches, if any.
+func (f *Forwarder) drainSpool(ctx context.Context) {
+	if f.opts.Spool == nil || f.opts.Spool.Len() == 0 {
+		return
+	}
+
+	err := f.opts.Spool.Drain(func(b []byte) error {
+		return dropPermanent(f.send(ctx, b))
+	})
+	if err != nil {
+		klog.V(2).InfoS("Spool not drained", "err", err)
+	}
+}
+
+// sendWithRetry sends the batch retrying the temporary failures.
+func (f *Forwarder) sendWithRetry(ctx context.Context, data []byte) error {
+	var lastErr error
+
+	err := wait.ExponentialBackoff(f.opts.Backoff, func() (bool, error) {
+		lastErr = f.send(ctx, data)
+		switch {
+		case lastErr == nil:
+			return true, nil
+		case errors.Is(lastErr, errPermanent):
+			return false, lastErr
+		case ctx.Err() != nil:
+			return false, ctx.Err()
+		default:
+			return false, nil
+		}
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return lastErr
+	}
+
+	return err
+}
+
+// errPermanent marks the failures that retrying cannot fix.
+var errPermanent = errors.New("permanent failure")
+
+// dropPermanent logs and discards a permanent failure of a spooled
+// batch, so that it does not block the ones spooled after it.
+func dropPermanent(err error) error {
+	if errors.Is(err, errPermanent) {
+		klog.ErrorS(err, "Dropping spooled batch rejected by the sink")
+		return nil
+	}
+	return err
+}
+
+// send POSTs the batch to the sink.
+func (f *Forwarder) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.opts.SinkURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", ContentTypeBatch)
+
+	resp, err := f.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return fmt.Errorf("sink answered %s", resp.Status)
+	default:
+		return fmt.Errorf("%w: sink answered %s", errPermanent, resp.Status)
+	}
+}
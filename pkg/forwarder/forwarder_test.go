@@ -0,0 +1,401 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// sink is an HTTP sink recording the ids of the received batches;
+// it answers with the status returned by the `status` function
+type sink struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	status  func() int
+	batches [][]string
+	times   []time.Time
+	// acks seen by the sink when each batch arrived
+	acked []int
+
+	acks *acks
+}
+
+func newSink(t *testing.T, a *acks) *sink {
+	t.Helper()
+
+	s := &sink{acks: a, status: func() int { return http.StatusOK }}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *sink) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.times = append(s.times, time.Now())
+
+	code := s.status()
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != ContentTypeBatch {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var events []CloudEvent
+	if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]string, 0, len(events))
+	for _, el := range events {
+		ids = append(ids, el.ID)
+	}
+	s.batches = append(s.batches, ids)
+	s.acked = append(s.acked, len(s.acks.list()))
+}
+
+func (s *sink) setStatus(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = func() int { return code }
+}
+
+func (s *sink) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func (s *sink) ackedOnArrival() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.acked...)
+}
+
+func (s *sink) requests() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.times...)
+}
+
+// acks records the acknowledged events, in order
+type acks struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (a *acks) fn(id string) func() {
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.ids = append(a.ids, id)
+	}
+}
+
+func (a *acks) list() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.ids...)
+}
+
+func ids(from, to int) []string {
+	var res []string
+	for i := from; i <= to; i++ {
+		res = append(res, fmt.Sprintf("e%d", i))
+	}
+	return res
+}
+
+// start runs the forwarder until the returned function is called
+func start(t *testing.T, opts Options) (*Forwarder, func()) {
+	t.Helper()
+
+	fwd := New(opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fwd.Run(ctx)
+	}()
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+
+	return fwd, stop
+}
+
+func enqueue(t *testing.T, fwd *Forwarder, a *acks, from, to int) {
+	t.Helper()
+
+	for _, id := range ids(from, to) {
+		if err := fwd.Enqueue(context.TODO(), CloudEvent{SpecVersion: "1.0", ID: id}, a.fn(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func fastBackoff(steps int) wait.Backoff {
+	return wait.Backoff{Duration: 20 * time.Millisecond, Factor: 2, Steps: steps}
+}
+
+func TestBatching(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+
+	fwd, stop := start(t, Options{SinkURL: s.URL, BatchSize: 3, FlushInterval: time.Hour})
+
+	enqueue(t, fwd, a, 1, 7)
+	waitFor(t, "two full batches", func() bool { return len(s.received()) == 2 })
+
+	// the pending batch is flushed on shutdown
+	stop()
+
+	expected := [][]string{ids(1, 3), ids(4, 6), ids(7, 7)}
+	if got := s.received(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got batches %v, expected %v", got, expected)
+	}
+	if got := a.list(); !reflect.DeepEqual(got, ids(1, 7)) {
+		t.Fatalf("got acks %v, expected %v", got, ids(1, 7))
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+
+	fwd, _ := start(t, Options{SinkURL: s.URL, BatchSize: 10, FlushInterval: 50 * time.Millisecond})
+
+	// the batch is not full: it is sent when the interval expires
+	enqueue(t, fwd, a, 1, 2)
+	waitFor(t, "the batch", func() bool { return len(s.received()) == 1 })
+
+	if got := s.received()[0]; !reflect.DeepEqual(got, ids(1, 2)) {
+		t.Fatalf("got batch %v, expected %v", got, ids(1, 2))
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+
+	// the sink fails twice
+	var calls int
+	s.status = func() int {
+		calls++
+		if calls <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	fwd, _ := start(t, Options{SinkURL: s.URL, BatchSize: 2, FlushInterval: time.Hour, Backoff: fastBackoff(5)})
+
+	enqueue(t, fwd, a, 1, 2)
+	waitFor(t, "the acks", func() bool { return len(a.list()) == 2 })
+
+	times := s.requests()
+	if len(times) != 3 {
+		t.Fatalf("got %d requests, expected 3", len(times))
+	}
+	// 20ms, then 40ms
+	for i, expected := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if got := times[i+1].Sub(times[i]); got < expected {
+			t.Fatalf("retry %d after %s, expected at least %s", i+1, got, expected)
+		}
+	}
+
+	if got := s.received(); !reflect.DeepEqual(got, [][]string{ids(1, 2)}) {
+		t.Fatalf("got batches %v, expected one", got)
+	}
+	// acknowledged only once delivered
+	if got := s.ackedOnArrival()[0]; got != 0 {
+		t.Fatalf("%d events acknowledged before the delivery", got)
+	}
+}
+
+func TestPermanentFailureIsNotRetried(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+	s.setStatus(http.StatusBadRequest)
+
+	fwd, _ := start(t, Options{SinkURL: s.URL, BatchSize: 1, FlushInterval: time.Hour, Backoff: fastBackoff(5)})
+
+	// dropped: acknowledged, not to block the ones after it
+	enqueue(t, fwd, a, 1, 1)
+	waitFor(t, "the ack", func() bool { return len(a.list()) == 1 })
+
+	if got := len(s.requests()); got != 1 {
+		t.Fatalf("got %d requests, expected 1", got)
+	}
+}
+
+func TestSpoolWhileTheSinkIsDown(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+	s.setStatus(http.StatusServiceUnavailable)
+
+	spool, err := NewSpool(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fwd, _ := start(t, Options{
+		SinkURL:       s.URL,
+		BatchSize:     2,
+		FlushInterval: 50 * time.Millisecond,
+		Backoff:       fastBackoff(2),
+		Spool:         spool,
+	})
+
+	// the batches are spooled: the events are safe, so acknowledged
+	enqueue(t, fwd, a, 1, 4)
+	waitFor(t, "the acks", func() bool { return len(a.list()) == 4 })
+
+	if got := spool.Len(); got != 2 {
+		t.Fatalf("got %d spooled batches, expected 2", got)
+	}
+	if got := s.received(); len(got) != 0 {
+		t.Fatalf("unexpected batches %v", got)
+	}
+
+	// the sink is back: the spool is drained, oldest first
+	s.setStatus(http.StatusOK)
+	waitFor(t, "the spooled batches", func() bool { return len(s.received()) == 2 })
+
+	enqueue(t, fwd, a, 5, 6)
+	waitFor(t, "the new batch", func() bool { return len(s.received()) == 3 })
+
+	expected := [][]string{ids(1, 2), ids(3, 4), ids(5, 6)}
+	if got := s.received(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got batches %v, expected %v", got, expected)
+	}
+	if got := spool.Len(); got != 0 {
+		t.Fatalf("got %d spooled batches, expected none", got)
+	}
+}
+
+func TestSpooledBatchesAreSentFirst(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+	s.setStatus(http.StatusServiceUnavailable)
+
+	spool, err := NewSpool(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fwd, _ := start(t, Options{
+		SinkURL:       s.URL,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Backoff:       fastBackoff(2),
+		Spool:         spool,
+	})
+
+	enqueue(t, fwd, a, 1, 2)
+	waitFor(t, "the spooled batch", func() bool { return spool.Len() == 1 })
+
+	// the next batch goes after the spooled one
+	s.setStatus(http.StatusOK)
+	enqueue(t, fwd, a, 3, 4)
+	waitFor(t, "the batches", func() bool { return len(s.received()) == 2 })
+
+	expected := [][]string{ids(1, 2), ids(3, 4)}
+	if got := s.received(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got batches %v, expected %v", got, expected)
+	}
+}
+
+func TestNotAcknowledgedWhenNotSafe(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+	s.setStatus(http.StatusServiceUnavailable)
+
+	// no room in the spool
+	spool, err := NewSpool(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fwd, stop := start(t, Options{
+		SinkURL:       s.URL,
+		BatchSize:     2,
+		FlushInterval: 20 * time.Millisecond,
+		Backoff:       fastBackoff(1),
+		Spool:         spool,
+	})
+
+	enqueue(t, fwd, a, 1, 2)
+	waitFor(t, "a few attempts", func() bool { return len(s.requests()) >= 3 })
+
+	// the events would be lost: they will be replayed on restart
+	stop()
+
+	if got := a.list(); len(got) != 0 {
+		t.Fatalf("got acks %v, expected none", got)
+	}
+}
+
+func TestAckOrdering(t *testing.T) {
+	a := &acks{}
+	s := newSink(t, a)
+
+	// the second batch needs a retry
+	var calls int
+	s.status = func() int {
+		calls++
+		if calls == 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	fwd, stop := start(t, Options{SinkURL: s.URL, BatchSize: 2, FlushInterval: time.Hour, Backoff: fastBackoff(5)})
+
+	enqueue(t, fwd, a, 1, 6)
+	waitFor(t, "the batches", func() bool { return len(s.received()) == 3 })
+	stop()
+
+	// the acks move the checkpoint forward: they must follow
+	// the order of the events, even across the batches
+	if got := a.list(); !reflect.DeepEqual(got, ids(1, 6)) {
+		t.Fatalf("got acks %v, expected %v", got, ids(1, 6))
+	}
+
+	// and no event is acknowledged before its batch is delivered
+	if expected := []int{0, 2, 4}; !reflect.DeepEqual(s.ackedOnArrival(), expected) {
+		t.Fatalf("acks seen by the sink %v, expected %v", s.ackedOnArrival(), expected)
+	}
+}
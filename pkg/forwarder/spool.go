@@ -0,0 +1,117 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSpoolFull is returned when the spool has no room for a batch.
+var ErrSpoolFull = errors.New("spool is full")
+
+// Spool is a bounded on-disk queue of batches, used to keep
+// the events while the sink is down.  Batches are kept one per
+// file and are sent back in the same order they were spooled.
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewSpool returns a `Spool` storing at most `maxBytes` in the specified directory.
+func NewSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Spool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Put saves a batch; it returns ErrSpoolFull if the size limit would be exceeded.
+func (s *Spool) Put(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, size, err := s.files()
+	if err != nil {
+		return err
+	}
+	if size+int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("%w (%d files, %d bytes)", ErrSpoolFull, len(files), size)
+	}
+
+	// names sort in the order the batches were spooled
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), s.seq))
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// Len returns the number of spooled batches.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, _, _ := s.files()
+	return len(files)
+}
+
+// Drain sends the spooled batches (oldest first), removing each
+// one as soon as it has been sent; it stops at the first error.
+func (s *Spool) Drain(send func([]byte) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, _, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, el := range files {
+		data, err := os.ReadFile(el)
+		if err != nil {
+			return err
+		}
+
+		if err := send(data); err != nil {
+			return err
+		}
+
+		if err := os.Remove(el); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// files returns the sorted spooled batches and their total size.
+func (s *Spool) files() ([]string, int64, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(matches)
+
+	var size int64
+	for _, el := range matches {
+		fi, err := os.Stat(el)
+		if err != nil {
+			return nil, 0, err
+		}
+		size += fi.Size()
+	}
+
+	return matches, size, nil
+}
@@ -0,0 +1,80 @@
+// Package handler provides typed, tombstone-safe informer event handlers.
+//
+// The informers deliver interface{} values: a delete notification, in
+// particular, can carry a cache.DeletedFinalStateUnknown tombstone instead
+// of the object (when the watch missed the deletion and the object
+// disappeared with a relist), so a plain `obj.(*corev1.Pod)` panics.
+//
+// Funcs unwraps the tombstones and converts the objects to the expected
+// type before calling the handler functions; unexpected objects are
+// reported (utilruntime.HandleError) and skipped.
+package handler
+
+import (
+	"fmt"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Funcs is a cache.ResourceEventHandler calling typed
+// functions (i.e. Funcs[*corev1.Pod]); nil functions are skipped.
+type Funcs[T any] struct {
+	AddFunc    func(obj T)
+	UpdateFunc func(oldObj, newObj T)
+	DeleteFunc func(obj T)
+}
+
+// OnAdd calls AddFunc if the object has the expected type.
+func (f Funcs[T]) OnAdd(obj interface{}) {
+	if f.AddFunc == nil {
+		return
+	}
+	if item, ok := As[T](obj); ok {
+		f.AddFunc(item)
+	}
+}
+
+// OnUpdate calls UpdateFunc if both objects have the expected type.
+func (f Funcs[T]) OnUpdate(oldObj, newObj interface{}) {
+	if f.UpdateFunc == nil {
+		return
+	}
+	oldItem, ok := As[T](oldObj)
+	if !ok {
+		return
+	}
+	newItem, ok := As[T](newObj)
+	if !ok {
+		return
+	}
+	f.UpdateFunc(oldItem, newItem)
+}
+
+// OnDelete calls DeleteFunc with the deleted object or, when the
+// deletion was missed, with its last known state from the tombstone.
+func (f Funcs[T]) OnDelete(obj interface{}) {
+	if f.DeleteFunc == nil {
+		return
+	}
+	if item, ok := As[T](obj); ok {
+		f.DeleteFunc(item)
+	}
+}
+
+var _ cache.ResourceEventHandler = Funcs[interface{}]{}
+
+// As unwraps the tombstones and converts the object to the specified
+// type; the failures are reported with utilruntime.HandleError.
+func As[T any](obj interface{}) (T, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	item, ok := obj.(T)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object of type %T, expecting %T", obj, item))
+	}
+
+	return item, ok
+}
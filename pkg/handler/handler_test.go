@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func pod(name string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: name, ResourceVersion: "1",
+	}}
+}
+
+// captureErrors collects the errors reported with utilruntime.HandleError
+func captureErrors(t *testing.T) func() []error {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+
+	handlers := utilruntime.ErrorHandlers
+	utilruntime.ErrorHandlers = []func(error){func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}}
+	t.Cleanup(func() { utilruntime.ErrorHandlers = handlers })
+
+	return func() []error {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]error(nil), errs...)
+	}
+}
+
+// fakeListWatch serves a different list at each (re)list
+// and fake watches, to drive the informer
+type fakeListWatch struct {
+	mu      sync.Mutex
+	lists   [][]corev1.Pod
+	watches []*watch.FakeWatcher
+}
+
+func (f *fakeListWatch) ListWatch() *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			if len(f.lists) == 0 {
+				return nil, errors.New("no more lists")
+			}
+			items := f.lists[0]
+			f.lists = f.lists[1:]
+
+			return &corev1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: "1"}, Items: items}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			w := watch.NewFake()
+			f.watches = append(f.watches, w)
+			return w, nil
+		},
+	}
+}
+
+func (f *fakeListWatch) watch(t *testing.T, i int) *watch.FakeWatcher {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		if len(f.watches) > i {
+			w := f.watches[i]
+			f.mu.Unlock()
+			return w
+		}
+		f.mu.Unlock()
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for watch %d", i)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeleteUnwrapsTombstones(t *testing.T) {
+	lw := &fakeListWatch{lists: [][]corev1.Pod{
+		{*pod("a"), *pod("b"), *pod("c")},
+		// "b" disappears while the watch is down
+		{*pod("a")},
+	}}
+
+	informer := cache.NewSharedIndexInformer(lw.ListWatch(), &corev1.Pod{}, 0, cache.Indexers{})
+
+	var (
+		mu      sync.Mutex
+		raw     []string
+		deleted []string
+	)
+
+	// what the informer actually delivers...
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			raw = append(raw, fmt.Sprintf("%T", obj))
+		},
+	})
+
+	// ...and what the typed handler receives
+	informer.AddEventHandler(Funcs[*corev1.Pod]{
+		DeleteFunc: func(obj *corev1.Pod) {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, obj.Name)
+		},
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("failed to sync")
+	}
+
+	// a deletion seen by the watch
+	lw.watch(t, 0).Delete(pod("c"))
+
+	// the watch cannot be resumed (410 Gone) and "b" is deleted
+	// meanwhile: the deletion is found by the relist
+	lw.watch(t, 0).Error(&metav1.Status{
+		Status: metav1.StatusFailure,
+		Code:   http.StatusGone,
+		Reason: metav1.StatusReasonExpired,
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(deleted)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, deleted: %v", deleted)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if expected := []string{"*v1.Pod", "cache.DeletedFinalStateUnknown"}; fmt.Sprint(raw) != fmt.Sprint(expected) {
+		t.Fatalf("informer delivered %v, expected %v", raw, expected)
+	}
+	if expected := []string{"c", "b"}; fmt.Sprint(deleted) != fmt.Sprint(expected) {
+		t.Fatalf("handler received %v, expected %v", deleted, expected)
+	}
+}
+
+func TestWrongTypeIsSkipped(t *testing.T) {
+	errs := captureErrors(t)
+
+	var calls int
+	h := Funcs[*corev1.Pod]{
+		AddFunc:    func(*corev1.Pod) { calls++ },
+		UpdateFunc: func(_, _ *corev1.Pod) { calls++ },
+		DeleteFunc: func(*corev1.Pod) { calls++ },
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cm"}}
+
+	h.OnAdd(cm)
+	h.OnUpdate(pod("a"), cm)
+	h.OnUpdate(cm, pod("a"))
+	h.OnDelete(cm)
+	h.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/cm", Obj: cm})
+
+	if calls != 0 {
+		t.Fatalf("the handler was called %d times with the wrong type", calls)
+	}
+	if got := len(errs()); got != 5 {
+		t.Fatalf("got %d reported errors, expected 5: %v", got, errs())
+	}
+}
+
+func TestNilFuncsAreSkipped(t *testing.T) {
+	errs := captureErrors(t)
+
+	// no panic and no error: there is nothing to call
+	h := Funcs[*corev1.Pod]{}
+	h.OnAdd(pod("a"))
+	h.OnUpdate(pod("a"), pod("a"))
+	h.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/a", Obj: pod("a")})
+
+	if got := errs(); len(got) != 0 {
+		t.Fatalf("unexpected errors: %v", got)
+	}
+}
+
+func TestAs(t *testing.T) {
+	captureErrors(t)
+
+	if got, ok := As[*corev1.Pod](pod("a")); !ok || got.Name != "a" {
+		t.Fatalf("got %v %t, expected pod a", got, ok)
+	}
+
+	tombstone := cache.DeletedFinalStateUnknown{Key: "default/a", Obj: pod("a")}
+	if got, ok := As[*corev1.Pod](tombstone); !ok || got.Name != "a" {
+		t.Fatalf("got %v %t, expected the pod of the tombstone", got, ok)
+	}
+
+	if got, ok := As[*corev1.Pod](nil); ok || got != nil {
+		t.Fatalf("got %v %t for nil, expected no pod", got, ok)
+	}
+}
@@ -0,0 +1,163 @@
+// Package indexers provides informer indexers answering common questions
+// ("which pods run on this node?", "which pods use this Secret?") from the
+// local cache, without hitting the API server.
+//
+// Register the indexers before starting the informer:
+//
+//	podsInformer.AddIndexers(cache.Indexers{
+//		indexers.PodsByNode:   indexers.PodNodeName,
+//		indexers.PodsBySecret: indexers.PodSecrets,
+//	})
+//
+// and query them with ByIndex (or Index):
+//
+//	pods, err := indexers.ByIndex[*corev1.Pod](podsInformer.GetIndexer(),
+//		indexers.PodsBySecret, "default/my-secret")
+package indexers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The index names.
+const (
+	// PodsByNode indexes the pods by node name.
+	PodsByNode = "pods-by-node"
+	// PodsBySecret indexes the pods by the namespace/name
+	// keys of the Secrets they use.
+	PodsBySecret = "pods-by-secret"
+	// ByOwnerUID indexes any object by the UIDs of its owners.
+	ByOwnerUID = "by-owner-uid"
+)
+
+// PodNodeName returns the node the pod is scheduled on (if any).
+func PodNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("expected a pod, got %T", obj)
+	}
+
+	if len(pod.Spec.NodeName) == 0 {
+		return nil, nil
+	}
+
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// PodSecrets returns the namespace/name keys of the Secrets used by
+// the pod: mounted as volumes (projected too), referenced by env and
+// envFrom of any container, or used to pull the images.
+func PodSecrets(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("expected a pod, got %T", obj)
+	}
+
+	names := map[string]struct{}{}
+	add := func(name string) {
+		if len(name) > 0 {
+			names[name] = struct{}{}
+		}
+	}
+
+	for _, el := range pod.Spec.Volumes {
+		if el.Secret != nil {
+			add(el.Secret.SecretName)
+		}
+		if el.Projected != nil {
+			for _, src := range el.Projected.Sources {
+				if src.Secret != nil {
+					add(src.Secret.Name)
+				}
+			}
+		}
+	}
+
+	for _, el := range pod.Spec.ImagePullSecrets {
+		add(el.Name)
+	}
+
+	visit := func(env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+		for _, el := range env {
+			if el.ValueFrom != nil && el.ValueFrom.SecretKeyRef != nil {
+				add(el.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+		for _, el := range envFrom {
+			if el.SecretRef != nil {
+				add(el.SecretRef.Name)
+			}
+		}
+	}
+
+	for _, el := range pod.Spec.InitContainers {
+		visit(el.Env, el.EnvFrom)
+	}
+	for _, el := range pod.Spec.Containers {
+		visit(el.Env, el.EnvFrom)
+	}
+	for _, el := range pod.Spec.EphemeralContainers {
+		visit(el.Env, el.EnvFrom)
+	}
+
+	// secrets can be used only in the pod namespace
+	res := make([]string, 0, len(names))
+	for name := range names {
+		res = append(res, pod.Namespace+"/"+name)
+	}
+
+	return res, nil
+}
+
+// OwnerUIDs returns the UIDs of the owners of any object.
+func OwnerUIDs(obj interface{}) ([]string, error) {
+	acc, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := acc.GetOwnerReferences()
+	res := make([]string, 0, len(refs))
+	for _, el := range refs {
+		res = append(res, string(el.UID))
+	}
+
+	return res, nil
+}
+
+// ByIndex returns the objects whose index values include the specified
+// one (i.e. the pods on a node), converted to the expected type.
+func ByIndex[T any](indexer cache.Indexer, indexName, value string) ([]T, error) {
+	items, err := indexer.ByIndex(indexName, value)
+	if err != nil {
+		return nil, err
+	}
+	return convert[T](items)
+}
+
+// Index returns the objects sharing at least one index value with the
+// specified one (i.e. the pods using any of the secrets used by a pod).
+func Index[T any](indexer cache.Indexer, indexName string, obj interface{}) ([]T, error) {
+	items, err := indexer.Index(indexName, obj)
+	if err != nil {
+		return nil, err
+	}
+	return convert[T](items)
+}
+
+// convert converts the cached objects to the expected type.
+func convert[T any](items []interface{}) ([]T, error) {
+	res := make([]T, 0, len(items))
+	for _, el := range items {
+		item, ok := el.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object of type %T, expecting %T", el, item)
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
@@ -0,0 +1,178 @@
+package indexers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func secretVolume(name string) corev1.Volume {
+	return corev1.Volume{VolumeSource: corev1.VolumeSource{
+		Secret: &corev1.SecretVolumeSource{SecretName: name},
+	}}
+}
+
+func secretEnv(name string) []corev1.EnvVar {
+	return []corev1.EnvVar{{ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}},
+	}}}
+}
+
+func sorted(values []string, err error) ([]string, error) {
+	sort.Strings(values)
+	return values, err
+}
+
+func TestPodNodeName(t *testing.T) {
+	got, err := PodNodeName(&corev1.Pod{Spec: corev1.PodSpec{NodeName: "node-1"}})
+	if err != nil || !reflect.DeepEqual(got, []string{"node-1"}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	// not scheduled yet
+	got, err = PodNodeName(&corev1.Pod{})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	if _, err := PodNodeName(&corev1.Secret{}); err == nil {
+		t.Fatal("a secret has been indexed")
+	}
+}
+
+func TestPodSecrets(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				secretVolume("volume"),
+				{VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected"}}},
+						// not a secret
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "config"}}},
+					},
+				}}},
+			},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			InitContainers:   []corev1.Container{{Env: secretEnv("init")}},
+			Containers: []corev1.Container{
+				{Env: secretEnv("env"), EnvFrom: []corev1.EnvFromSource{
+					{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-from"}}},
+				}},
+				// used twice
+				{Env: secretEnv("volume")},
+			},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Env: secretEnv("debug")}},
+			},
+		},
+	}
+
+	got, err := sorted(PodSecrets(pod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"default/debug", "default/env", "default/env-from", "default/init",
+		"default/projected", "default/registry", "default/volume",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestOwnerUIDs(t *testing.T) {
+	// any kind of object
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{UID: "a"}, {UID: "b"}},
+	}}
+
+	got, err := OwnerUIDs(rs)
+	if err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	if _, err := OwnerUIDs("not an object"); err == nil {
+		t.Fatal("an object without metadata has been indexed")
+	}
+}
+
+func TestByIndex(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		PodsByNode:   PodNodeName,
+		PodsBySecret: PodSecrets,
+		ByOwnerUID:   OwnerUIDs,
+	})
+
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a",
+				OwnerReferences: []metav1.OwnerReference{{UID: types.UID("rs-1")}}},
+			Spec: corev1.PodSpec{NodeName: "node-1", Volumes: []corev1.Volume{secretVolume("token")}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"},
+			Spec: corev1.PodSpec{NodeName: "node-2", Volumes: []corev1.Volume{secretVolume("token")},
+				Containers: []corev1.Container{{Env: secretEnv("password")}}},
+		},
+		{
+			// same secret name, other namespace
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "c"},
+			Spec:       corev1.PodSpec{NodeName: "node-1", Volumes: []corev1.Volume{secretVolume("token")}},
+		},
+	}
+	for _, el := range pods {
+		if err := indexer.Add(el); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(pods []*corev1.Pod, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := []string{}
+		for _, el := range pods {
+			res = append(res, el.Name)
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	tests := []struct {
+		index, value string
+		expected     []string
+	}{
+		{PodsByNode, "node-1", []string{"a", "c"}},
+		{PodsByNode, "node-3", []string{}},
+		{PodsBySecret, "default/token", []string{"a", "b"}},
+		{PodsBySecret, "other/token", []string{"c"}},
+		{ByOwnerUID, "rs-1", []string{"a"}},
+	}
+	for _, tc := range tests {
+		if got := names(ByIndex[*corev1.Pod](indexer, tc.index, tc.value)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s=%s: got %v, expected %v", tc.index, tc.value, got, tc.expected)
+		}
+	}
+
+	// the pods sharing a secret with b
+	if got := names(Index[*corev1.Pod](indexer, PodsBySecret, pods[1])); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got %v, expected [a b]", got)
+	}
+
+	if _, err := ByIndex[*corev1.Pod](indexer, "unknown", "x"); err == nil {
+		t.Error("an unknown index has been queried")
+	}
+	if _, err := ByIndex[*corev1.Secret](indexer, PodsByNode, "node-1"); err == nil {
+		t.Error("the pods have been converted to secrets")
+	}
+}
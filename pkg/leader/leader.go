@@ -0,0 +1,254 @@
+// Package leader elects, among the replicas of a controller, the one
+// running the workers, using a coordination.k8s.io Lease as lock.
+//
+// The standbys keep running their informers, so their caches are warm
+// when they take over.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// Config holds the leader election settings.
+type Config struct {
+	// Namespace and Name of the Lease.
+	Namespace string
+	Name      string
+	// Identity of this replica (default hostname_uuid).
+	Identity string
+	// LeaseDuration is how long the standbys wait before taking
+	// over a lease that has not been renewed (default 15s).
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps trying to renew
+	// the lease before giving up the leadership (default 10s).
+	RenewDeadline time.Duration
+	// RetryPeriod is how often the lease is acquired or renewed (default 2s).
+	RetryPeriod time.Duration
+}
+
+// ErrLeadershipLost is returned by Run when the lease could not be
+// renewed: the process should exit and restart as a standby.
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// Elector runs a function only while this replica is the leader.
+type Elector struct {
+	elector  *leaderelection.LeaderElector
+	identity string
+	run      func(ctx context.Context)
+	// how long, once the leadership is lost, the lease
+	// cannot be acquired by another replica (worst case)
+	grace time.Duration
+
+	// the state of Run
+	mu      sync.Mutex
+	ctx     context.Context
+	stop    context.CancelFunc
+	leading bool
+	done    chan struct{}
+}
+
+// New returns an `Elector` calling run when the leadership is acquired:
+// the context passed to run is canceled when the leadership is lost
+// (or the context passed to Run is done).
+func New(cs kubernetes.Interface, cfg Config, run func(ctx context.Context)) (*Elector, error) {
+	if len(cfg.Identity) == 0 {
+		cfg.Identity = DefaultIdentity()
+	}
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = 15 * time.Second
+	}
+	if cfg.RenewDeadline == 0 {
+		cfg.RenewDeadline = 10 * time.Second
+	}
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = 2 * time.Second
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Namespace: cfg.Namespace, Name: cfg.Name},
+		Client:    cs.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: cfg.Identity,
+		},
+	}
+
+	e := &Elector{
+		identity: cfg.Identity,
+		run:      run,
+		// the last renewal happened at least RenewDeadline ago
+		grace: cfg.LeaseDuration - cfg.RenewDeadline,
+	}
+
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: cfg.LeaseDuration,
+		RenewDeadline: cfg.RenewDeadline,
+		RetryPeriod:   cfg.RetryPeriod,
+		// give up the lease on shutdown: the standbys
+		// do not have to wait for it to expire
+		ReleaseOnCancel: true,
+		Name:            cfg.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) { e.lead(ctx) },
+			OnStoppedLeading: func() {
+				klog.InfoS("Leadership lost", "lease", cfg.Name, "identity", cfg.Identity)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != cfg.Identity {
+					klog.InfoS("New leader elected", "lease", cfg.Name, "leader", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("leader election %s/%s: %w", cfg.Namespace, cfg.Name, err)
+	}
+
+	e.elector = le
+
+	return e, nil
+}
+
+// Run tries to acquire the leadership and, once acquired, calls run;
+// it returns when the context is done or the leadership is lost.
+//
+// On shutdown the lease is released only once run has returned, so the
+// leader can drain its queue before a standby takes over.
+//
+// When the leadership is lost instead (the lease could not be renewed
+// within RenewDeadline), another replica can acquire the lease as soon
+// as LeaseDuration - RenewDeadline later: Run waits for run to return
+// at most that long, then returns ErrLeadershipLost anyway.  Since run
+// could be still running, the caller must exit at once (i.e. keep the
+// drain of the queue shorter than that, to complete it).
+//
+// Run must be called once.
+func (e *Elector) Run(ctx context.Context) error {
+	// the election outlives ctx until run returns
+	electionCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	e.mu.Lock()
+	e.ctx, e.stop, e.done = ctx, stop, make(chan struct{})
+	e.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-electionCtx.Done():
+			return
+		}
+
+		// not leading: nothing to wait for
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if !e.leading {
+			stop()
+		}
+	}()
+
+	e.elector.Run(electionCtx)
+	// on shutdown it returns once the lease is released (by lead)
+	lost := electionCtx.Err() == nil
+
+	e.mu.Lock()
+	leading := e.leading
+	e.mu.Unlock()
+
+	if leading && !lost {
+		<-e.done
+	}
+	if leading && lost {
+		select {
+		case <-e.done:
+		case <-time.After(e.grace):
+			klog.ErrorS(ErrLeadershipLost, "Still running, while another replica could lead",
+				"identity", e.identity, "grace", e.grace)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return ErrLeadershipLost
+}
+
+// lead calls run until the leadership is lost or the
+// Run context is done, then ends the election
+func (e *Elector) lead(leaderCtx context.Context) {
+	e.mu.Lock()
+	if e.ctx.Err() != nil || leaderCtx.Err() != nil {
+		// shutting down (or already lost)
+		e.mu.Unlock()
+		e.stop()
+		return
+	}
+	e.leading = true
+	e.mu.Unlock()
+
+	defer close(e.done)
+	// releases the lease (if still held)
+	defer e.stop()
+
+	ctx, cancel := context.WithCancel(leaderCtx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-e.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	e.run(ctx)
+}
+
+// IsLeader tells if this replica is the leader.
+func (e *Elector) IsLeader() bool {
+	return e.elector.IsLeader()
+}
+
+// Leader returns the identity of the last observed leader.
+func (e *Elector) Leader() string {
+	return e.elector.GetLeader()
+}
+
+// Ready returns nil when the election works: this replica is the
+// leader or a standby that knows the leader (an error otherwise).
+func (e *Elector) Ready() error {
+	if e.IsLeader() {
+		return nil
+	}
+	if len(e.Leader()) == 0 {
+		return fmt.Errorf("no leader elected yet")
+	}
+	return nil
+}
+
+// Identity returns the identity of this replica.
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+// DefaultIdentity returns the hostname (the pod name, in a cluster)
+// followed by a random suffix, so two processes never share it.
+func DefaultIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "_" + string(uuid.NewUUID())
+}
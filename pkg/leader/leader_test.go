@@ -0,0 +1,231 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// replica is an Elector counting the items it processes while leading
+type replica struct {
+	elector *Elector
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// returned by Run
+	err error
+
+	mu        sync.Mutex
+	processed int
+}
+
+func (r *replica) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.processed
+}
+
+func startReplica(t *testing.T, cs *fake.Clientset, identity string) *replica {
+	t.Helper()
+
+	r := &replica{done: make(chan struct{})}
+
+	// while leading, an item is processed every 10ms
+	run := func(ctx context.Context) {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.mu.Lock()
+				r.processed++
+				r.mu.Unlock()
+			}
+		}
+	}
+
+	e, err := New(cs, Config{
+		Namespace:     "default",
+		Name:          "test-lease",
+		Identity:      identity,
+		LeaseDuration: 1 * time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.elector = e
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		defer close(r.done)
+		r.err = e.Run(ctx)
+	}()
+
+	return r
+}
+
+func (r *replica) stop(t *testing.T) {
+	t.Helper()
+
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("elector did not return after the cancellation")
+	}
+
+	// a shutdown, not a lost leadership
+	if r.err != nil {
+		t.Fatalf("got %v, expected no error", r.err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestOnlyTheLeaderRuns(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	a := startReplica(t, cs, "a")
+	waitFor(t, "a to lead", a.elector.IsLeader)
+
+	b := startReplica(t, cs, "b")
+	defer b.stop(t)
+	defer a.stop(t)
+
+	waitFor(t, "b to see the leader", func() bool { return b.elector.Leader() == "a" })
+
+	// let both run for a while
+	time.Sleep(500 * time.Millisecond)
+
+	if b.elector.IsLeader() {
+		t.Fatal("b should be a standby")
+	}
+	if got := a.count(); got == 0 {
+		t.Fatal("the leader processed no items")
+	}
+	if got := b.count(); got != 0 {
+		t.Fatalf("the standby processed %d items, expected none", got)
+	}
+	if err := b.elector.Ready(); err != nil {
+		t.Fatalf("a standby knowing the leader should be ready, got: %v", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	a := startReplica(t, cs, "a")
+	waitFor(t, "a to lead", a.elector.IsLeader)
+
+	b := startReplica(t, cs, "b")
+	defer b.stop(t)
+
+	waitFor(t, "b to see the leader", func() bool { return b.elector.Leader() == "a" })
+
+	// the leader stops renewing the lease
+	a.stop(t)
+	processedByA := a.count()
+
+	waitFor(t, "b to take over", b.elector.IsLeader)
+	waitFor(t, "b to process items", func() bool { return b.count() > 0 })
+
+	if a.elector.IsLeader() {
+		t.Fatal("a should not be leading anymore")
+	}
+	if got := a.count(); got != processedByA {
+		t.Fatalf("a processed items after stopping: %d, expected %d", got, processedByA)
+	}
+}
+
+func TestReadyWithoutLeader(t *testing.T) {
+	e, err := New(fake.NewSimpleClientset(), Config{Namespace: "default", Name: "test-lease"},
+		func(ctx context.Context) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Ready(); err == nil {
+		t.Fatal("expected an error before any leader is elected")
+	}
+}
+
+func TestLostLeadershipIsBounded(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	// the lease cannot be renewed anymore, once acquired
+	var renewing int32
+	cs.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if atomic.LoadInt32(&renewing) == 1 {
+			return true, nil, errors.New("boom")
+		}
+		return false, nil, nil
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	// a drain longer than the grace period
+	e, err := New(cs, Config{
+		Namespace:     "default",
+		Name:          "test-lease",
+		LeaseDuration: 1 * time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- e.Run(context.Background()) }()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the leadership")
+	}
+	atomic.StoreInt32(&renewing, 1)
+	lost := time.Now()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrLeadershipLost) {
+			t.Fatalf("got %v, expected %v", err, ErrLeadershipLost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run waited for the whole drain")
+	}
+
+	// RenewDeadline to notice, LeaseDuration-RenewDeadline of grace
+	if elapsed := time.Since(lost); elapsed < 500*time.Millisecond {
+		t.Fatalf("returned after %s, before the grace period", elapsed)
+	}
+}
@@ -0,0 +1,155 @@
+// Package metrics exposes the metrics of the client-go work queues
+// as Prometheus collectors, labelled with the name of the queue.
+//
+//	metrics.RegisterWorkqueue(prometheus.DefaultRegisterer)
+//
+// must be called before the (named) queues are created: the
+// queues created before get no metrics.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// WorkqueueSubsystem prefixes the names of the workqueue metrics.
+const WorkqueueSubsystem = "workqueue"
+
+// WorkqueueProvider is a workqueue.MetricsProvider and a
+// prometheus.Collector: it creates the metrics of each queue, labelled
+// with the queue name, and collects them.
+type WorkqueueProvider struct {
+	depth          *prometheus.GaugeVec
+	adds           *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	workDuration   *prometheus.HistogramVec
+	unfinished     *prometheus.GaugeVec
+	longestRunning *prometheus.GaugeVec
+	retries        *prometheus.CounterVec
+}
+
+var registerOnce sync.Once
+
+// RegisterWorkqueue registers the workqueue metrics and sets them as
+// the workqueue metrics provider (only the first call has effect).
+func RegisterWorkqueue(registerer prometheus.Registerer) {
+	registerOnce.Do(func() {
+		p := NewWorkqueueProvider()
+		registerer.MustRegister(p)
+		workqueue.SetProvider(p)
+	})
+}
+
+// NewWorkqueueProvider returns a `WorkqueueProvider`; the metrics
+// are the same exposed by the Kubernetes controllers.
+func NewWorkqueueProvider() *WorkqueueProvider {
+	return &WorkqueueProvider{
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "depth",
+			Help:      "Current depth of the workqueue.",
+		}, []string{"name"}),
+
+		adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "adds_total",
+			Help:      "Total number of adds handled by the workqueue.",
+		}, []string{"name"}),
+
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "queue_duration_seconds",
+			Help:      "How long in seconds an item stays in the workqueue before being requested.",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, []string{"name"}),
+
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "work_duration_seconds",
+			Help:      "How long in seconds processing an item from the workqueue takes.",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, []string{"name"}),
+
+		unfinished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "unfinished_work_seconds",
+			Help: "How many seconds of work has been done that is in progress and hasn't " +
+				"been observed by work_duration. Large values indicate stuck threads.",
+		}, []string{"name"}),
+
+		longestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "longest_running_processor_seconds",
+			Help:      "How many seconds has the longest running processor for the workqueue been running.",
+		}, []string{"name"}),
+
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: WorkqueueSubsystem,
+			Name:      "retries_total",
+			Help:      "Total number of retries handled by the workqueue.",
+		}, []string{"name"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (p *WorkqueueProvider) Describe(ch chan<- *prometheus.Desc) {
+	for _, el := range p.collectors() {
+		el.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (p *WorkqueueProvider) Collect(ch chan<- prometheus.Metric) {
+	for _, el := range p.collectors() {
+		el.Collect(ch)
+	}
+}
+
+func (p *WorkqueueProvider) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		p.depth, p.adds, p.latency, p.workDuration,
+		p.unfinished, p.longestRunning, p.retries,
+	}
+}
+
+// NewDepthMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+// NewAddsMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+// NewLatencyMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+// NewWorkDurationMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+// NewUnfinishedWorkSecondsMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinished.WithLabelValues(name)
+}
+
+// NewLongestRunningProcessorSecondsMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunning.WithLabelValues(name)
+}
+
+// NewRetriesMetric implements workqueue.MetricsProvider.
+func (p *WorkqueueProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
+
+var (
+	_ workqueue.MetricsProvider = (*WorkqueueProvider)(nil)
+	_ prometheus.Collector      = (*WorkqueueProvider)(nil)
+)
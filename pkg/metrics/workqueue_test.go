@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// the workqueue metrics provider can be set only once per process
+var testRegistry = func() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	RegisterWorkqueue(reg)
+	return reg
+}()
+
+func TestWorkqueueMetrics(t *testing.T) {
+	// a new queue for every run (i.e. -count)
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	reg := &queueMetrics{Registry: testRegistry, name: name}
+
+	q := workqueue.NewNamedRateLimitingQueue(
+		workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond), name)
+	defer q.ShutDown()
+
+	q.Add("a")
+	q.Add("b")
+
+	expectValue(t, reg, "workqueue_adds_total", 2)
+	expectValue(t, reg, "workqueue_depth", 2)
+
+	// "a" is being processed: the unfinished work
+	// is updated every 500ms by the queue
+	item, _ := q.Get()
+	time.Sleep(1100 * time.Millisecond)
+
+	expectValue(t, reg, "workqueue_depth", 1)
+	if got := value(t, reg, "workqueue_unfinished_work_seconds"); got < 0.5 {
+		t.Fatalf("workqueue_unfinished_work_seconds: got %v, expected at least 0.5", got)
+	}
+	if got := value(t, reg, "workqueue_longest_running_processor_seconds"); got < 0.5 {
+		t.Fatalf("workqueue_longest_running_processor_seconds: got %v, expected at least 0.5", got)
+	}
+
+	// "a" fails and is retried
+	q.AddRateLimited(item)
+	q.Done(item)
+
+	expectValue(t, reg, "workqueue_retries_total", 1)
+
+	if got := sampleCount(t, reg, "workqueue_work_duration_seconds"); got != 1 {
+		t.Fatalf("workqueue_work_duration_seconds: got %d observations, expected 1", got)
+	}
+
+	// the retried "a" comes back after the rate limiter delay
+	time.Sleep(50 * time.Millisecond)
+	expectValue(t, reg, "workqueue_adds_total", 3)
+	expectValue(t, reg, "workqueue_depth", 2)
+
+	for i := 0; i < 2; i++ {
+		item, _ := q.Get()
+		q.Forget(item)
+		q.Done(item)
+	}
+
+	expectValue(t, reg, "workqueue_depth", 0)
+	if got := sampleCount(t, reg, "workqueue_work_duration_seconds"); got != 3 {
+		t.Fatalf("workqueue_work_duration_seconds: got %d observations, expected 3", got)
+	}
+	if got := sampleCount(t, reg, "workqueue_queue_duration_seconds"); got != 3 {
+		t.Fatalf("workqueue_queue_duration_seconds: got %d observations, expected 3", got)
+	}
+
+	// the metrics are labelled with the queue name
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+# HELP workqueue_retries_total Total number of retries handled by the workqueue.
+# TYPE workqueue_retries_total counter
+workqueue_retries_total{name=%q} 1
+`, name)), "workqueue_retries_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queueMetrics gathers only the metrics of the named queue
+type queueMetrics struct {
+	*prometheus.Registry
+	name string
+}
+
+// Gather implements prometheus.Gatherer.
+func (q *queueMetrics) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := q.Registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mf := range mfs {
+		var metrics []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "name" && l.GetValue() == q.name {
+					metrics = append(metrics, m)
+				}
+			}
+		}
+		mf.Metric = metrics
+	}
+
+	return mfs, nil
+}
+
+// value returns the value of the gauge or counter
+func value(t *testing.T, reg prometheus.Gatherer, name string) float64 {
+	t.Helper()
+
+	m := metric(t, reg, name)
+	switch {
+	case m.GetGauge() != nil:
+		return m.GetGauge().GetValue()
+	case m.GetCounter() != nil:
+		return m.GetCounter().GetValue()
+	}
+
+	t.Fatalf("%s is neither a gauge nor a counter", name)
+	return 0
+}
+
+func expectValue(t *testing.T, reg prometheus.Gatherer, name string, expected float64) {
+	t.Helper()
+
+	if got := value(t, reg, name); got != expected {
+		t.Fatalf("%s: got %v, expected %v", name, got, expected)
+	}
+}
+
+// sampleCount returns the number of observations of the histogram
+func sampleCount(t *testing.T, reg prometheus.Gatherer, name string) uint64 {
+	t.Helper()
+
+	return metric(t, reg, name).GetHistogram().GetSampleCount()
+}
+
+// metric returns the series of the queue
+func metric(t *testing.T, reg prometheus.Gatherer, name string) *dto.Metric {
+	t.Helper()
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		if len(mf.GetMetric()) > 0 {
+			return mf.GetMetric()[0]
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return nil
+}
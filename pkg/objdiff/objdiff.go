@@ -0,0 +1,194 @@
+// Package objdiff compares two versions of the same object
+// (in their unstructured form) and reports the changed fields.
+package objdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Operation is the kind of change.
+type Operation string
+
+const (
+	// Add means the field exists only in the new version.
+	Add Operation = "add"
+	// Remove means the field exists only in the old version.
+	Remove Operation = "remove"
+	// Replace means the field value has changed.
+	Replace Operation = "replace"
+)
+
+// Change describes a changed field.
+type Change struct {
+	// Op is the kind of change.
+	Op Operation `json:"op"`
+	// Path is the JSON Pointer (RFC 6901) of the field.
+	Path string `json:"path"`
+	// Old is the old value; nil when Op is Add.
+	Old interface{} `json:"old,omitempty"`
+	// New is the new value; nil when Op is Remove.
+	New interface{} `json:"new,omitempty"`
+}
+
+// String returns a human readable representation of the change.
+func (c Change) String() string {
+	switch c.Op {
+	case Add:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case Remove:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %v => %v", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff returns the changes needed to go from the old to the new object.
+// Maps are compared key by key (in sorted order), slices item by item.
+func Diff(old, new map[string]interface{}) []Change {
+	var res []Change
+	diffValues("", old, new, &res)
+	return res
+}
+
+func diffValues(path string, old, new interface{}, res *[]Change) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			diffMaps(path, o, n, res)
+			return
+		}
+
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			diffSlices(path, o, n, res)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*res = append(*res, Change{Op: Replace, Path: path, Old: old, New: new})
+	}
+}
+
+func diffMaps(path string, old, new map[string]interface{}, res *[]Change) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := path + "/" + escape(k)
+
+		o, inOld := old[k]
+		n, inNew := new[k]
+
+		switch {
+		case !inOld:
+			*res = append(*res, Change{Op: Add, Path: p, New: n})
+		case !inNew:
+			*res = append(*res, Change{Op: Remove, Path: p, Old: o})
+		default:
+			diffValues(p, o, n, res)
+		}
+	}
+}
+
+func diffSlices(path string, old, new []interface{}, res *[]Change) {
+	i := 0
+	for ; i < len(old) && i < len(new); i++ {
+		diffValues(fmt.Sprintf("%s/%d", path, i), old[i], new[i], res)
+	}
+
+	for j := i; j < len(new); j++ {
+		*res = append(*res, Change{Op: Add, Path: fmt.Sprintf("%s/%d", path, j), New: new[j]})
+	}
+
+	// removals from the tail, so that the indexes
+	// stay valid if the changes are applied in order
+	for j := len(old) - 1; j >= i; j-- {
+		*res = append(*res, Change{Op: Remove, Path: fmt.Sprintf("%s/%d", path, j), Old: old[j]})
+	}
+}
+
+// escape encodes a key as a JSON Pointer reference token.
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// NoisePaths are the fields changing at every update (or
+// maintained by the API server) that are usually not interesting.
+var NoisePaths = []string{
+	"/metadata/managedFields",
+	"/metadata/resourceVersion",
+	"/metadata/generation",
+}
+
+// Without returns the changes that do not concern the specified
+// paths or any of their children (i.e. /metadata/managedFields).
+func Without(changes []Change, paths ...string) []Change {
+	res := make([]Change, 0, len(changes))
+
+	for _, el := range changes {
+		if !hasPrefix(el.Path, paths) {
+			res = append(res, el)
+		}
+	}
+
+	return res
+}
+
+// hasPrefix returns true if path is equal to (or is a child of) one of the prefixes.
+func hasPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONPatch returns the changes as a JSON Patch (RFC 6902) document.
+func JSONPatch(changes []Change) ([]byte, error) {
+	ops := make([]map[string]interface{}, 0, len(changes))
+	for _, el := range changes {
+		op := map[string]interface{}{"op": el.Op, "path": el.Path}
+		if el.Op != Remove {
+			// always present, even when null
+			op["value"] = el.New
+		}
+		ops = append(ops, op)
+	}
+
+	return json.Marshal(ops)
+}
+
+// Fprint writes the changes to w, one per line, or as a JSON Patch
+// document; every line is indented, to show under the changed object.
+func Fprint(w io.Writer, changes []Change, asPatch bool) error {
+	if !asPatch {
+		for _, el := range changes {
+			if _, err := fmt.Fprintf(w, "    %s\n", el); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	patch, err := JSONPatch(changes)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "    %s\n", patch)
+	return err
+}
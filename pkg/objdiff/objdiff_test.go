@@ -0,0 +1,170 @@
+package objdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// obj parses a JSON object
+func obj(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+
+	var res map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestDiff(t *testing.T) {
+	tests := map[string]struct {
+		old, new string
+		expected []Change
+	}{
+		"unchanged": {
+			old: `{"a": 1, "b": {"c": [1, 2]}}`,
+			new: `{"a": 1, "b": {"c": [1, 2]}}`,
+		},
+		"top level": {
+			old: `{"a": 1, "b": "x"}`,
+			new: `{"b": "y", "c": true}`,
+			expected: []Change{
+				{Op: Remove, Path: "/a", Old: 1.0},
+				{Op: Replace, Path: "/b", Old: "x", New: "y"},
+				{Op: Add, Path: "/c", New: true},
+			},
+		},
+		"nested": {
+			old: `{"metadata": {"labels": {"app": "nginx", "tier": "web"}}}`,
+			new: `{"metadata": {"labels": {"app": "nginx", "tier": "cache"}, "annotations": {"a": "b"}}}`,
+			expected: []Change{
+				{Op: Add, Path: "/metadata/annotations", New: map[string]interface{}{"a": "b"}},
+				{Op: Replace, Path: "/metadata/labels/tier", Old: "web", New: "cache"},
+			},
+		},
+		"escaped keys": {
+			old: `{"labels": {"app.kubernetes.io/name": "a", "x~y": 1}}`,
+			new: `{"labels": {"app.kubernetes.io/name": "b", "x~y": 2}}`,
+			expected: []Change{
+				{Op: Replace, Path: "/labels/app.kubernetes.io~1name", Old: "a", New: "b"},
+				{Op: Replace, Path: "/labels/x~0y", Old: 1.0, New: 2.0},
+			},
+		},
+		"list items changed": {
+			old: `{"spec": {"containers": [{"name": "a", "image": "nginx:1"}, {"name": "b"}]}}`,
+			new: `{"spec": {"containers": [{"name": "a", "image": "nginx:2"}, {"name": "b"}]}}`,
+			expected: []Change{
+				{Op: Replace, Path: "/spec/containers/0/image", Old: "nginx:1", New: "nginx:2"},
+			},
+		},
+		"list grown": {
+			old: `{"finalizers": ["a"]}`,
+			new: `{"finalizers": ["a", "b", "c"]}`,
+			expected: []Change{
+				{Op: Add, Path: "/finalizers/1", New: "b"},
+				{Op: Add, Path: "/finalizers/2", New: "c"},
+			},
+		},
+		"list shrunk": {
+			old: `{"finalizers": ["a", "b", "c"]}`,
+			new: `{"finalizers": ["x"]}`,
+			expected: []Change{
+				{Op: Replace, Path: "/finalizers/0", Old: "a", New: "x"},
+				// from the tail
+				{Op: Remove, Path: "/finalizers/2", Old: "c"},
+				{Op: Remove, Path: "/finalizers/1", Old: "b"},
+			},
+		},
+		"type changed": {
+			old: `{"a": {"b": 1}}`,
+			new: `{"a": [1]}`,
+			expected: []Change{
+				{Op: Replace, Path: "/a", Old: map[string]interface{}{"b": 1.0}, New: []interface{}{1.0}},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		got := Diff(obj(t, tc.old), obj(t, tc.new))
+		if len(got) == 0 && len(tc.expected) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %+v, expected %+v", name, got, tc.expected)
+		}
+	}
+}
+
+func TestWithout(t *testing.T) {
+	changes := []Change{
+		{Op: Replace, Path: "/metadata/resourceVersion"},
+		{Op: Add, Path: "/metadata/managedFields/0"},
+		{Op: Add, Path: "/metadata/managedFieldsX"},
+		{Op: Replace, Path: "/metadata/labels/app"},
+	}
+
+	got := Without(changes, NoisePaths...)
+
+	expected := []Change{
+		// not a child of /metadata/managedFields
+		{Op: Add, Path: "/metadata/managedFieldsX"},
+		{Op: Replace, Path: "/metadata/labels/app"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	old := obj(t, `{"metadata": {"labels": {"a": "1", "b": "2"}}, "finalizers": ["x", "y"], "spec": {"n": 1}}`)
+	new := obj(t, `{"metadata": {"labels": {"a": "3", "c": null}}, "finalizers": ["x"], "spec": {"n": 1}}`)
+
+	patch, err := JSONPatch(Diff(old, new))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[` +
+		`{"op":"remove","path":"/finalizers/1"},` +
+		`{"op":"replace","path":"/metadata/labels/a","value":"3"},` +
+		`{"op":"remove","path":"/metadata/labels/b"},` +
+		// null values are kept
+		`{"op":"add","path":"/metadata/labels/c","value":null}` +
+		`]`
+	if string(patch) != expected {
+		t.Fatalf("got %s, expected %s", patch, expected)
+	}
+
+	// no changes, an empty patch
+	if patch, _ := JSONPatch(nil); string(patch) != "[]" {
+		t.Fatalf("got %s, expected []", patch)
+	}
+}
+
+func TestFprint(t *testing.T) {
+	changes := []Change{
+		{Op: Add, Path: "/a", New: 1},
+		{Op: Remove, Path: "/b", Old: "x"},
+		{Op: Replace, Path: "/c", Old: true, New: false},
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, changes, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "    + /a: 1\n    - /b: x\n    ~ /c: true => false\n"
+	if got := buf.String(); got != expected {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+
+	buf.Reset()
+	if err := Fprint(&buf, changes[:1], true); err != nil {
+		t.Fatal(err)
+	}
+	expected = "    [{\"op\":\"add\",\"path\":\"/a\",\"value\":1}]\n"
+	if got := buf.String(); got != expected {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,65 @@
+package objdiff
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Tracker keeps the last seen version of each watched object,
+// so that the changes carried by a MODIFIED event can be computed.
+//
+// The objects are tracked by namespace/name (not by UID): a DELETED
+// event built knowing just the name (i.e. after a relist) forgets
+// the object as well.
+type Tracker struct {
+	last    map[string]map[string]interface{}
+	ignored []string
+}
+
+// NewTracker returns a new `Tracker`; the changes concerning
+// the specified paths (i.e. NoisePaths) will not be reported.
+func NewTracker(ignored ...string) *Tracker {
+	return &Tracker{
+		last:    map[string]map[string]interface{}{},
+		ignored: ignored,
+	}
+}
+
+// Observe records the object of a watch event (typed or unstructured)
+// and, for MODIFIED events, returns what changed since the last version.
+func (t *Tracker) Observe(et watch.EventType, obj runtime.Object) ([]Change, error) {
+	acc, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	key := acc.GetNamespace() + "/" + acc.GetName()
+
+	if et == watch.Deleted {
+		delete(t.last, key)
+		return nil, nil
+	}
+
+	cur, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	old, ok := t.last[key]
+	t.last[key] = cur
+
+	if et != watch.Modified || !ok {
+		return nil, nil
+	}
+
+	return Without(Diff(old, cur), t.ignored...), nil
+}
+
+// toUnstructured returns the map representation of the object.
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy().Object, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
@@ -0,0 +1,107 @@
+package objdiff
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func namespace(rv string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:            "demo",
+		UID:             "uid-1",
+		ResourceVersion: rv,
+		Labels:          labels,
+	}}
+}
+
+func observe(t *testing.T, tr *Tracker, et watch.EventType, obj *corev1.Namespace) []Change {
+	t.Helper()
+
+	changes, err := tr.Observe(et, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(NoisePaths...)
+
+	// nothing to compare with
+	if got := observe(t, tr, watch.Added, namespace("1", nil)); len(got) != 0 {
+		t.Fatalf("ADDED: unexpected changes %+v", got)
+	}
+
+	got := observe(t, tr, watch.Modified, namespace("2", map[string]string{"team": "a"}))
+	expected := []Change{
+		{Op: Add, Path: "/metadata/labels", New: map[string]interface{}{"team": "a"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("MODIFIED: got %+v, expected %+v", got, expected)
+	}
+
+	// only the resourceVersion changed (ignored)
+	if got := observe(t, tr, watch.Modified, namespace("3", map[string]string{"team": "a"})); len(got) != 0 {
+		t.Fatalf("MODIFIED: unexpected changes %+v", got)
+	}
+
+	observe(t, tr, watch.Deleted, namespace("4", nil))
+	if len(tr.last) != 0 {
+		t.Fatalf("still tracking %d objects after the deletion", len(tr.last))
+	}
+
+	// forgotten: nothing to compare with
+	if got := observe(t, tr, watch.Modified, namespace("5", nil)); len(got) != 0 {
+		t.Fatalf("MODIFIED: unexpected changes %+v", got)
+	}
+}
+
+func TestTrackerDeleteByName(t *testing.T) {
+	tr := NewTracker()
+
+	observe(t, tr, watch.Added, namespace("1", nil))
+
+	// i.e. after a relist, only the name of the deleted object is known
+	observe(t, tr, watch.Deleted, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}})
+
+	if len(tr.last) != 0 {
+		t.Fatalf("still tracking %d objects after the deletion", len(tr.last))
+	}
+}
+
+func TestTrackerUnstructured(t *testing.T) {
+	tr := NewTracker()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("bella.napoli.it/v1alpha1")
+	obj.SetKind("Pizza")
+	obj.SetNamespace("default")
+	obj.SetName("margherita")
+	if err := unstructured.SetNestedField(obj.Object, 6.5, "spec", "price"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tr.Observe(watch.Added, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tracked version is a copy
+	if err := unstructured.SetNestedField(obj.Object, 7.0, "spec", "price"); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := tr.Observe(watch.Modified, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Change{{Op: Replace, Path: "/spec/price", Old: 6.5, New: 7.0}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("got %+v, expected %+v", changes, expected)
+	}
+}
@@ -0,0 +1,128 @@
+// Package pipeline filters and transforms the events
+// coming from a watch.Interface through composable stages.
+//
+// Since stages only rely on the object metadata, they work
+// both with typed and unstructured objects:
+//
+//	w := pipeline.New(watcher,
+//		pipeline.EventTypes(watch.Added, watch.Deleted),
+//		pipeline.Namespaces("default"),
+//		pipeline.Dedupe(),
+//	)
+//	for event := range w.ResultChan() {
+//		...
+//	}
+package pipeline
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Stage reads events from the `in` channel and writes the resulting
+// events to the returned channel.  A stage must close the returned
+// channel when `in` is closed or when `stop` is closed.
+type Stage func(stop <-chan struct{}, in <-chan watch.Event) <-chan watch.Event
+
+// pipeline implements watch.Interface.
+type pipeline struct {
+	source watch.Interface
+	result <-chan watch.Event
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New returns a watch.Interface whose events are the ones of
+// the source watcher after they went through all the stages.
+func New(source watch.Interface, stages ...Stage) watch.Interface {
+	p := &pipeline{
+		source: source,
+		stop:   make(chan struct{}),
+	}
+
+	ch := source.ResultChan()
+	for _, s := range stages {
+		ch = s(p.stop, ch)
+	}
+	p.result = ch
+
+	return p
+}
+
+// Stop stops the source watcher and all the stages.
+func (p *pipeline) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+		p.source.Stop()
+	})
+}
+
+// ResultChan returns the channel with the resulting events.
+func (p *pipeline) ResultChan() <-chan watch.Event {
+	return p.result
+}
+
+var _ watch.Interface = (*pipeline)(nil)
+
+// FanOut returns `n` watchers, each receiving all the source
+// events; the consumers are served at the pace of the slowest one.
+// Stopping a consumer does not stop the others; once all of them
+// are stopped, the source is stopped too.  Stopping the source (or
+// its natural end) closes all the consumers.
+func FanOut(source watch.Interface, n int) []watch.Interface {
+	b := watch.NewBroadcaster(0, watch.WaitIfChannelFull)
+
+	// stops the source when the last consumer is stopped
+	var mu sync.Mutex
+	running := n
+	stopped := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		running--
+		if running == 0 {
+			source.Stop()
+		}
+	}
+
+	res := make([]watch.Interface, n)
+	for i := range res {
+		res[i] = &consumer{Interface: b.Watch(), stopped: stopped}
+	}
+
+	go func() {
+		defer b.Shutdown()
+		for event := range source.ResultChan() {
+			b.Action(event.Type, event.Object)
+		}
+	}()
+
+	return res
+}
+
+// consumer is a FanOut watcher telling when it is stopped.
+type consumer struct {
+	watch.Interface
+	once    sync.Once
+	stopped func()
+}
+
+// Stop stops receiving the source events.
+func (c *consumer) Stop() {
+	c.once.Do(func() {
+		c.Interface.Stop()
+		c.stopped()
+	})
+}
+
+// send writes the event to the channel, unless stop is closed first;
+// it returns false if the stage has to stop.
+func send(stop <-chan struct{}, out chan<- watch.Event, event watch.Event) bool {
+	select {
+	case out <- event:
+		return true
+	case <-stop:
+		return false
+	}
+}
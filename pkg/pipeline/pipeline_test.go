@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestStopClosesTheStages(t *testing.T) {
+	source := watch.NewFake()
+	w := New(source, Filter(func(watch.Event) bool { return true }), Dedupe(), Debounce(time.Hour))
+
+	w.Stop()
+	// twice is fine
+	w.Stop()
+
+	if got := collect(t, w.ResultChan()); len(got) != 0 {
+		t.Fatalf("unexpected events %v", describe(got))
+	}
+	if !source.IsStopped() {
+		t.Fatal("the source has not been stopped")
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	source := watch.NewFakeWithChanSize(2, false)
+	source.Add(pod("default", "a", "1", nil))
+	source.Delete(pod("default", "a", "2", nil))
+	source.Stop()
+
+	consumers := FanOut(source, 2)
+
+	// served at the pace of the slowest: they must be read together
+	got := make([][]string, len(consumers))
+	var wg sync.WaitGroup
+	for i, el := range consumers {
+		wg.Add(1)
+		go func(i int, w watch.Interface) {
+			defer wg.Done()
+			got[i] = describe(collect(t, w.ResultChan()))
+		}(i, el)
+	}
+	wg.Wait()
+
+	for _, el := range got {
+		expectEvents(t, el, "ADDED default/a@1", "DELETED default/a@2")
+	}
+}
+
+func TestFanOutStopsTheSource(t *testing.T) {
+	source := watch.NewFake()
+	consumers := FanOut(source, 2)
+
+	consumers[0].Stop()
+	if source.IsStopped() {
+		t.Fatal("the source has been stopped while a consumer is still there")
+	}
+
+	// the other consumer still receives the events
+	go source.Add(pod("default", "a", "1", nil))
+	select {
+	case el := <-consumers[1].ResultChan():
+		expectEvents(t, describe([]watch.Event{el}), "ADDED default/a@1")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	consumers[1].Stop()
+	// twice is fine
+	consumers[1].Stop()
+
+	if !source.IsStopped() {
+		t.Fatal("the source has not been stopped with the last consumer")
+	}
+}
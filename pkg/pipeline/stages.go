@@ -0,0 +1,283 @@
+package pipeline
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// minDebounceTick bounds how often Debounce checks the pending events.
+const minDebounceTick = time.Millisecond
+
+// Filter returns a stage that keeps only the events
+// for which the specified function returns true.
+func Filter(keep func(watch.Event) bool) Stage {
+	return func(stop <-chan struct{}, in <-chan watch.Event) <-chan watch.Event {
+		out := make(chan watch.Event)
+
+		go func() {
+			defer close(out)
+			for event := range in {
+				if !keep(event) {
+					continue
+				}
+				if !send(stop, out, event) {
+					return
+				}
+			}
+		}()
+
+		return out
+	}
+}
+
+// Map returns a stage that replaces each event
+// with the one returned by the specified function.
+func Map(fn func(watch.Event) watch.Event) Stage {
+	return func(stop <-chan struct{}, in <-chan watch.Event) <-chan watch.Event {
+		out := make(chan watch.Event)
+
+		go func() {
+			defer close(out)
+			for event := range in {
+				if !send(stop, out, fn(event)) {
+					return
+				}
+			}
+		}()
+
+		return out
+	}
+}
+
+// EventTypes returns a stage that keeps only the events of the specified types.
+func EventTypes(types ...watch.EventType) Stage {
+	return Filter(func(event watch.Event) bool {
+		for _, t := range types {
+			if event.Type == t {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Object returns a stage that keeps only the events whose object satisfies
+// the specified predicate; events without metadata (i.e. errors) are kept.
+func Object(predicate func(runtime.Object) bool) Stage {
+	return Filter(func(event watch.Event) bool {
+		if _, err := meta.Accessor(event.Object); err != nil {
+			return true
+		}
+		return predicate(event.Object)
+	})
+}
+
+// Namespaces returns a stage that keeps only
+// the objects living in the specified namespaces.
+func Namespaces(namespaces ...string) Stage {
+	return Object(func(obj runtime.Object) bool {
+		acc, _ := meta.Accessor(obj)
+		for _, ns := range namespaces {
+			if acc.GetNamespace() == ns {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// LabelSelector returns a stage that keeps only
+// the objects whose labels match the selector.
+func LabelSelector(sel labels.Selector) Stage {
+	return Object(func(obj runtime.Object) bool {
+		acc, _ := meta.Accessor(obj)
+		return sel.Matches(labels.Set(acc.GetLabels()))
+	})
+}
+
+// FieldSelector returns a stage that keeps only the objects whose fields
+// match the selector; like the API server does for every kind of object,
+// only `metadata.name` and `metadata.namespace` are supported.
+func FieldSelector(sel fields.Selector) Stage {
+	return Object(func(obj runtime.Object) bool {
+		acc, _ := meta.Accessor(obj)
+		return sel.Matches(fields.Set{
+			"metadata.name":      acc.GetName(),
+			"metadata.namespace": acc.GetNamespace(),
+		})
+	})
+}
+
+// Dedupe returns a stage that drops the events already seen,
+// recognized by the object namespace/name and resourceVersion.  Only
+// the last resourceVersion of each object is remembered, until its
+// deletion.  The events without a named object (i.e. errors and
+// bookmarks) are never dropped.
+func Dedupe() Stage {
+	return func(stop <-chan struct{}, in <-chan watch.Event) <-chan watch.Event {
+		out := make(chan watch.Event)
+
+		go func() {
+			defer close(out)
+
+			seen := map[string]string{}
+			for event := range in {
+				if key, rv, ok := objectKey(event); ok {
+					if last, ok := seen[key]; ok && last == rv {
+						continue
+					}
+
+					if event.Type == watch.Deleted {
+						delete(seen, key)
+					} else {
+						seen[key] = rv
+					}
+				}
+
+				if !send(stop, out, event) {
+					return
+				}
+			}
+		}()
+
+		return out
+	}
+}
+
+// Debounce returns a stage that collapses the bursts of events for the
+// same object: an event is emitted only after the object has been quiet
+// for the specified duration, carrying its latest state (the objects are
+// recognized by namespace/name).  An ADDED followed by MODIFIED events is
+// emitted as ADDED; a DELETED replaces the pending event of the object
+// and, like any event without a named object (i.e. errors and bookmarks,
+// which first flush all the pending events), is emitted at once.
+// A non-positive duration disables the debouncing (events pass through).
+func Debounce(quiet time.Duration) Stage {
+	if quiet <= 0 {
+		return Map(func(event watch.Event) watch.Event { return event })
+	}
+
+	// how often the pending events are checked
+	tick := quiet / 2
+	if tick < minDebounceTick {
+		tick = minDebounceTick
+	}
+
+	return func(stop <-chan struct{}, in <-chan watch.Event) <-chan watch.Event {
+		out := make(chan watch.Event)
+
+		go func() {
+			defer close(out)
+
+			type pending struct {
+				event watch.Event
+				due   time.Time
+			}
+
+			queue := map[string]*pending{}
+			// keeps the emission order stable
+			order := []string{}
+
+			ticker := time.NewTicker(tick)
+			defer ticker.Stop()
+
+			// flush emits the pending events that are due (or all of them)
+			flush := func(all bool) bool {
+				now := time.Now()
+				kept := order[:0]
+				for _, key := range order {
+					p := queue[key]
+					if !all && now.Before(p.due) {
+						kept = append(kept, key)
+						continue
+					}
+					delete(queue, key)
+					if !send(stop, out, p.event) {
+						return false
+					}
+				}
+				order = kept
+				return true
+			}
+
+			for {
+				select {
+				case <-stop:
+					return
+
+				case <-ticker.C:
+					if !flush(false) {
+						return
+					}
+
+				case event, ok := <-in:
+					if !ok {
+						flush(true)
+						return
+					}
+
+					key, _, ok := objectKey(event)
+					if !ok {
+						// i.e. errors and bookmarks: do not reorder them
+						if !flush(true) || !send(stop, out, event) {
+							return
+						}
+						continue
+					}
+
+					if event.Type == watch.Deleted {
+						// the pending event is superseded by the deletion
+						if _, ok := queue[key]; ok {
+							delete(queue, key)
+							order = remove(order, key)
+						}
+						if !send(stop, out, event) {
+							return
+						}
+						continue
+					}
+
+					if p, ok := queue[key]; ok {
+						if p.event.Type != watch.Added {
+							p.event.Type = event.Type
+						}
+						p.event.Object = event.Object
+						p.due = time.Now().Add(quiet)
+						continue
+					}
+
+					queue[key] = &pending{event: event, due: time.Now().Add(quiet)}
+					order = append(order, key)
+				}
+			}
+		}()
+
+		return out
+	}
+}
+
+// objectKey returns the namespace/name and the resourceVersion of the
+// event object; ok is false when the object has no metadata or no name
+// (i.e. errors and bookmarks).
+func objectKey(event watch.Event) (key, rv string, ok bool) {
+	acc, err := meta.Accessor(event.Object)
+	if err != nil || len(acc.GetName()) == 0 {
+		return "", "", false
+	}
+	return acc.GetNamespace() + "/" + acc.GetName(), acc.GetResourceVersion(), true
+}
+
+// remove returns the slice without the specified key.
+func remove(keys []string, key string) []string {
+	for i, el := range keys {
+		if el == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,297 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func pod(namespace, name, rv string, lbls map[string]string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       namespace,
+		Name:            name,
+		UID:             types.UID(namespace + "/" + name),
+		ResourceVersion: rv,
+		Labels:          lbls,
+	}}
+}
+
+func event(et watch.EventType, obj *corev1.Pod) watch.Event {
+	return watch.Event{Type: et, Object: obj}
+}
+
+func errorEvent() watch.Event {
+	return watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure}}
+}
+
+// describe returns "TYPE namespace/name@rv" (or "ERROR")
+func describe(events []watch.Event) []string {
+	res := make([]string, 0, len(events))
+	for _, el := range events {
+		if p, ok := el.Object.(*corev1.Pod); ok {
+			res = append(res, fmt.Sprintf("%s %s/%s@%s", el.Type, p.Namespace, p.Name, p.ResourceVersion))
+			continue
+		}
+		res = append(res, string(el.Type))
+	}
+	return res
+}
+
+// collect reads the events until the channel is closed
+func collect(t *testing.T, ch <-chan watch.Event) []watch.Event {
+	t.Helper()
+
+	var res []watch.Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case el, ok := <-ch:
+			if !ok {
+				return res
+			}
+			res = append(res, el)
+		case <-timeout:
+			t.Fatalf("timed out, got %v", describe(res))
+		}
+	}
+}
+
+// run sends the events through the stages and returns what comes out
+func run(t *testing.T, events []watch.Event, stages ...Stage) []string {
+	t.Helper()
+
+	source := watch.NewFakeWithChanSize(len(events), false)
+	for _, el := range events {
+		source.Action(el.Type, el.Object)
+	}
+	source.Stop()
+
+	w := New(source, stages...)
+	defer w.Stop()
+
+	return describe(collect(t, w.ResultChan()))
+}
+
+func expectEvents(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+
+	if len(got) == 0 && len(expected) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestEventTypes(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Modified, pod("default", "a", "2", nil)),
+		event(watch.Bookmark, pod("", "", "3", nil)),
+		event(watch.Deleted, pod("default", "a", "4", nil)),
+	}, EventTypes(watch.Added, watch.Deleted))
+
+	expectEvents(t, got, "ADDED default/a@1", "DELETED default/a@4")
+}
+
+func TestMap(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+	}, Map(func(event watch.Event) watch.Event {
+		p := event.Object.(*corev1.Pod).DeepCopy()
+		p.Name = "mapped"
+		return watch.Event{Type: watch.Modified, Object: p}
+	}))
+
+	expectEvents(t, got, "MODIFIED default/mapped@1")
+}
+
+func TestNamespaces(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Added, pod("kube-system", "b", "2", nil)),
+		event(watch.Added, pod("demo", "c", "3", nil)),
+		errorEvent(),
+	}, Namespaces("default", "demo"))
+
+	// the errors have no namespace, but they are kept
+	expectEvents(t, got, "ADDED default/a@1", "ADDED demo/c@3", "ERROR")
+}
+
+func TestLabelSelector(t *testing.T) {
+	sel, err := labels.Parse("app=nginx,tier!=cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", map[string]string{"app": "nginx"})),
+		event(watch.Added, pod("default", "b", "2", map[string]string{"app": "nginx", "tier": "cache"})),
+		event(watch.Added, pod("default", "c", "3", nil)),
+	}, LabelSelector(sel))
+
+	expectEvents(t, got, "ADDED default/a@1")
+}
+
+func TestFieldSelector(t *testing.T) {
+	sel, err := fields.ParseSelector("metadata.namespace=default,metadata.name!=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Added, pod("default", "b", "2", nil)),
+		event(watch.Added, pod("demo", "a", "3", nil)),
+	}, FieldSelector(sel))
+
+	expectEvents(t, got, "ADDED default/a@1")
+}
+
+func TestDedupe(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		// replayed (i.e. after a watch restart)
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Modified, pod("default", "a", "2", nil)),
+		event(watch.Modified, pod("default", "a", "2", nil)),
+		event(watch.Deleted, pod("default", "a", "3", nil)),
+		// recreated with the same name
+		event(watch.Added, pod("default", "a", "1", nil)),
+		errorEvent(),
+		errorEvent(),
+	}, Dedupe())
+
+	expectEvents(t, got,
+		"ADDED default/a@1",
+		"MODIFIED default/a@2",
+		"DELETED default/a@3",
+		"ADDED default/a@1",
+		"ERROR",
+		"ERROR",
+	)
+}
+
+func TestDedupeWithoutUIDs(t *testing.T) {
+	noUID := func(name, rv string) *corev1.Pod {
+		p := pod("default", name, rv, nil)
+		p.UID = ""
+		return p
+	}
+
+	got := run(t, []watch.Event{
+		// i.e. built knowing just the name: no collisions
+		event(watch.Added, noUID("a", "1")),
+		event(watch.Added, noUID("b", "1")),
+		event(watch.Added, noUID("b", "1")),
+		// bookmarks have no name: never dropped
+		event(watch.Bookmark, pod("", "", "2", nil)),
+		event(watch.Bookmark, pod("", "", "2", nil)),
+	}, Dedupe())
+
+	expectEvents(t, got, "ADDED default/a@1", "ADDED default/b@1", "BOOKMARK /@2", "BOOKMARK /@2")
+}
+
+func TestStagesCompose(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Modified, pod("kube-system", "b", "2", nil)),
+		event(watch.Deleted, pod("default", "a", "3", nil)),
+	}, EventTypes(watch.Added, watch.Modified), Namespaces("default"), Dedupe())
+
+	expectEvents(t, got, "ADDED default/a@1")
+}
+
+func TestDebounceCollapsesBursts(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Modified, pod("default", "a", "2", nil)),
+		event(watch.Modified, pod("default", "b", "3", nil)),
+		event(watch.Modified, pod("default", "a", "4", nil)),
+		event(watch.Modified, pod("default", "b", "5", nil)),
+	}, Debounce(time.Hour))
+
+	// the end of the source flushes the pending events, in order;
+	// "a" is still ADDED, with its latest state
+	expectEvents(t, got, "ADDED default/a@4", "MODIFIED default/b@5")
+}
+
+func TestDebounceDeletionsAndErrors(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		event(watch.Modified, pod("default", "b", "2", nil)),
+		// emitted at once, superseding the pending ADDED
+		event(watch.Deleted, pod("default", "a", "3", nil)),
+		// flushes the pending events first
+		errorEvent(),
+		event(watch.Modified, pod("default", "b", "4", nil)),
+	}, Debounce(time.Hour))
+
+	expectEvents(t, got, "DELETED default/a@3", "MODIFIED default/b@2", "ERROR", "MODIFIED default/b@4")
+}
+
+func TestDebounceBookmarks(t *testing.T) {
+	got := run(t, []watch.Event{
+		event(watch.Added, pod("default", "a", "1", nil)),
+		// flushes the pending events first, not to skip them
+		event(watch.Bookmark, pod("", "", "2", nil)),
+		event(watch.Modified, pod("default", "a", "3", nil)),
+		event(watch.Bookmark, pod("", "", "4", nil)),
+	}, Debounce(time.Hour))
+
+	expectEvents(t, got, "ADDED default/a@1", "BOOKMARK /@2", "MODIFIED default/a@3", "BOOKMARK /@4")
+}
+
+func TestDebounceEmitsAfterTheQuietPeriod(t *testing.T) {
+	source := watch.NewFake()
+	w := New(source, Debounce(50*time.Millisecond))
+	defer w.Stop()
+
+	start := time.Now()
+	source.Add(pod("default", "a", "1", nil))
+	source.Modify(pod("default", "a", "2", nil))
+
+	select {
+	case el := <-w.ResultChan():
+		if got := describe([]watch.Event{el}); got[0] != "ADDED default/a@2" {
+			t.Fatalf("got %q, expected the latest state", got)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("emitted after %s, before the quiet period", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestDebounceTinyAndNonPositiveDurations(t *testing.T) {
+	// no panic: the check interval is bounded
+	for _, quiet := range []time.Duration{1, 3 * time.Nanosecond} {
+		got := run(t, []watch.Event{
+			event(watch.Added, pod("default", "a", "1", nil)),
+			event(watch.Modified, pod("default", "b", "2", nil)),
+		}, Debounce(quiet))
+
+		expectEvents(t, got, "ADDED default/a@1", "MODIFIED default/b@2")
+	}
+
+	// no debouncing at all
+	for _, quiet := range []time.Duration{-time.Second, 0} {
+		got := run(t, []watch.Event{
+			event(watch.Added, pod("default", "a", "1", nil)),
+			event(watch.Modified, pod("default", "a", "2", nil)),
+			event(watch.Deleted, pod("default", "a", "3", nil)),
+		}, Debounce(quiet))
+
+		expectEvents(t, got, "ADDED default/a@1", "MODIFIED default/a@2", "DELETED default/a@3")
+	}
+}
@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Enforcer applies a Policy to the namespaces.
+type Enforcer struct {
+	client kubernetes.Interface
+	policy *Policy
+
+	// FieldManager is the name of the actor making the changes.
+	FieldManager string
+	// DryRun sends all the requests with DryRun: All, so the changes
+	// are validated by the API server but not persisted.
+	DryRun bool
+}
+
+// NewEnforcer returns a new `Enforcer` of the specified policy.
+func NewEnforcer(client kubernetes.Interface, policy *Policy, fieldManager string) *Enforcer {
+	return &Enforcer{
+		client:       client,
+		policy:       policy,
+		FieldManager: fieldManager,
+	}
+}
+
+// Enforce makes the namespace comply with the policy, fixing any drift
+// (missing or changed labels, annotations and templated objects);
+// it returns the description of the actions taken (none if the
+// namespace already complies).
+func (e *Enforcer) Enforce(ctx context.Context, ns *corev1.Namespace) ([]string, error) {
+	var actions []string
+
+	patch, err := e.policy.Patch(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch != nil {
+		_, err = e.client.CoreV1().Namespaces().Patch(ctx, ns.Name,
+			types.MergePatchType, patch, e.patchOptions())
+		if err != nil {
+			return actions, err
+		}
+		actions = append(actions, fmt.Sprintf("patched metadata %s", patch))
+	}
+
+	for _, rule := range e.policy.Matching(ns) {
+		for _, el := range rule.ResourceQuotas {
+			act, err := e.ensureResourceQuota(ctx, ns.Name, el)
+			if err != nil {
+				return actions, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			actions = appendIf(actions, act)
+		}
+
+		for _, el := range rule.LimitRanges {
+			act, err := e.ensureLimitRange(ctx, ns.Name, el)
+			if err != nil {
+				return actions, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			actions = appendIf(actions, act)
+		}
+
+		for _, el := range rule.NetworkPolicies {
+			act, err := e.ensureNetworkPolicy(ctx, ns.Name, el)
+			if err != nil {
+				return actions, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			actions = appendIf(actions, act)
+		}
+	}
+
+	return actions, nil
+}
+
+// ensureResourceQuota creates the ResourceQuota or restores its spec.
+func (e *Enforcer) ensureResourceQuota(ctx context.Context, namespace string, tpl corev1.ResourceQuota) (string, error) {
+	want := tpl.DeepCopy()
+	want.Namespace = namespace
+
+	client := e.client.CoreV1().ResourceQuotas(namespace)
+
+	cur, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, e.createOptions())
+		return created("ResourceQuota", want.Name, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if equality.Semantic.DeepDerivative(want.Spec, cur.Spec) {
+		return "", nil
+	}
+
+	cur.Spec = want.Spec
+	_, err = client.Update(ctx, cur, e.updateOptions())
+	return updated("ResourceQuota", want.Name, err)
+}
+
+// ensureLimitRange creates the LimitRange or restores its spec.
+func (e *Enforcer) ensureLimitRange(ctx context.Context, namespace string, tpl corev1.LimitRange) (string, error) {
+	want := tpl.DeepCopy()
+	want.Namespace = namespace
+
+	client := e.client.CoreV1().LimitRanges(namespace)
+
+	cur, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, e.createOptions())
+		return created("LimitRange", want.Name, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if equality.Semantic.DeepDerivative(want.Spec, cur.Spec) {
+		return "", nil
+	}
+
+	cur.Spec = want.Spec
+	_, err = client.Update(ctx, cur, e.updateOptions())
+	return updated("LimitRange", want.Name, err)
+}
+
+// ensureNetworkPolicy creates the NetworkPolicy or restores its spec.
+func (e *Enforcer) ensureNetworkPolicy(ctx context.Context, namespace string, tpl networkingv1.NetworkPolicy) (string, error) {
+	want := tpl.DeepCopy()
+	want.Namespace = namespace
+
+	client := e.client.NetworkingV1().NetworkPolicies(namespace)
+
+	cur, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, e.createOptions())
+		return created("NetworkPolicy", want.Name, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if equality.Semantic.DeepDerivative(want.Spec, cur.Spec) {
+		return "", nil
+	}
+
+	cur.Spec = want.Spec
+	_, err = client.Update(ctx, cur, e.updateOptions())
+	return updated("NetworkPolicy", want.Name, err)
+}
+
+func (e *Enforcer) patchOptions() metav1.PatchOptions {
+	return metav1.PatchOptions{FieldManager: e.FieldManager, DryRun: e.dryRun()}
+}
+
+func (e *Enforcer) createOptions() metav1.CreateOptions {
+	return metav1.CreateOptions{FieldManager: e.FieldManager, DryRun: e.dryRun()}
+}
+
+func (e *Enforcer) updateOptions() metav1.UpdateOptions {
+	return metav1.UpdateOptions{FieldManager: e.FieldManager, DryRun: e.dryRun()}
+}
+
+func (e *Enforcer) dryRun() []string {
+	if e.DryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+func created(kind, name string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("created %s %s", kind, name), nil
+}
+
+func updated(kind, name string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("restored %s %s", kind, name), nil
+}
+
+func appendIf(actions []string, act string) []string {
+	if len(act) == 0 {
+		return actions
+	}
+	return append(actions, act)
+}
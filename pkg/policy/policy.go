@@ -0,0 +1,222 @@
+// Package policy implements a small namespace labelling policy engine.
+//
+// A Policy is a list of rules read from a YAML file; each rule matches
+// namespaces by name (glob patterns) and/or by their existing labels and
+// describes what a matching namespace must have: labels, annotations and
+// templated objects (ResourceQuota, LimitRange, NetworkPolicy) created in it.
+//
+//	rules:
+//	  - name: team-quota
+//	    match:
+//	      names: ["team-*"]
+//	      selector:
+//	        matchLabels:
+//	          tier: dev
+//	    labels:
+//	      owner: platform
+//	    resourceQuotas:
+//	      - metadata:
+//	          name: default-quota
+//	        spec:
+//	          hard:
+//	            pods: "10"
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy is an ordered list of rules; when many rules set the same
+// label (or annotation) the last one wins.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule describes what the matching namespaces must have.
+type Rule struct {
+	// Name identifies the rule in logs and events.
+	Name string `json:"name"`
+	// Match selects the namespaces the rule applies to.
+	Match Match `json:"match,omitempty"`
+
+	// Labels and Annotations are set on the matching namespaces.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Templates of the objects created in the matching namespaces
+	// (their namespace is always the matching one).
+	ResourceQuotas  []corev1.ResourceQuota       `json:"resourceQuotas,omitempty"`
+	LimitRanges     []corev1.LimitRange          `json:"limitRanges,omitempty"`
+	NetworkPolicies []networkingv1.NetworkPolicy `json:"networkPolicies,omitempty"`
+}
+
+// Match selects namespaces by name and by labels; both conditions
+// must be true, an empty condition matches everything.
+type Match struct {
+	// Names are glob patterns (see path.Match) of the namespace name.
+	Names []string `json:"names,omitempty"`
+	// Selector is a label selector of the namespace labels.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Default returns the policy equivalent to the patch that the
+// watching examples used to apply: just add a custom label.
+func Default() *Policy {
+	return &Policy{
+		Rules: []Rule{
+			{
+				Name:   "modified-by",
+				Labels: map[string]string{"modified-by": "lucasepe"},
+			},
+		},
+	}
+}
+
+// Load reads and validates a policy from a YAML (or JSON) file.
+func Load(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pol := &Policy{}
+	if err := yaml.UnmarshalStrict(data, pol); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", filename, err)
+	}
+
+	if err := pol.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", filename, err)
+	}
+
+	return pol, nil
+}
+
+// Validate checks the patterns, the selectors and the template names.
+func (p *Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if len(rule.Name) == 0 {
+			return fmt.Errorf("rule #%d: missing name", i+1)
+		}
+
+		for _, el := range rule.Match.Names {
+			if _, err := path.Match(el, ""); err != nil {
+				return fmt.Errorf("rule %s: bad name pattern '%s': %w", rule.Name, el, err)
+			}
+		}
+
+		if rule.Match.Selector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(rule.Match.Selector); err != nil {
+				return fmt.Errorf("rule %s: bad selector: %w", rule.Name, err)
+			}
+		}
+
+		for _, el := range rule.templateNames() {
+			if len(el) == 0 {
+				return fmt.Errorf("rule %s: template without metadata.name", rule.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Matching returns the rules that apply to the namespace.
+func (p *Policy) Matching(ns metav1.Object) []Rule {
+	var res []Rule
+	for _, el := range p.Rules {
+		if el.Matches(ns) {
+			res = append(res, el)
+		}
+	}
+	return res
+}
+
+// Matches returns true if the rule applies to the namespace.
+func (r *Rule) Matches(ns metav1.Object) bool {
+	if len(r.Match.Names) > 0 {
+		found := false
+		for _, el := range r.Match.Names {
+			if ok, _ := path.Match(el, ns.GetName()); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.Match.Selector != nil {
+		sel, err := metav1.LabelSelectorAsSelector(r.Match.Selector)
+		if err != nil || !sel.Matches(labels.Set(ns.GetLabels())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// templateNames returns the names of all the templates of the rule.
+func (r *Rule) templateNames() []string {
+	var res []string
+	for _, el := range r.ResourceQuotas {
+		res = append(res, el.Name)
+	}
+	for _, el := range r.LimitRanges {
+		res = append(res, el.Name)
+	}
+	for _, el := range r.NetworkPolicies {
+		res = append(res, el.Name)
+	}
+	return res
+}
+
+// Patch returns the merge patch that sets on the namespace the labels
+// and annotations it is missing (or that have a different value);
+// nil means that the namespace already complies with the policy.
+func (p *Policy) Patch(ns metav1.Object) ([]byte, error) {
+	wantLabels := map[string]string{}
+	wantAnnotations := map[string]string{}
+	for _, rule := range p.Matching(ns) {
+		for k, v := range rule.Labels {
+			wantLabels[k] = v
+		}
+		for k, v := range rule.Annotations {
+			wantAnnotations[k] = v
+		}
+	}
+
+	meta := map[string]interface{}{}
+	if drift := missing(ns.GetLabels(), wantLabels); len(drift) > 0 {
+		meta["labels"] = drift
+	}
+	if drift := missing(ns.GetAnnotations(), wantAnnotations); len(drift) > 0 {
+		meta["annotations"] = drift
+	}
+
+	if len(meta) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(map[string]interface{}{"metadata": meta})
+}
+
+// missing returns the wanted entries that are not in have.
+func missing(have, want map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range want {
+		if cur, ok := have[k]; !ok || cur != v {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,136 @@
+// Package recorder creates the EventRecorder used by the examples
+// to report, as core Events, what they do to the objects.
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Recorder is a record.EventRecorder that knows how many events have
+// been recorded and written, so short lived programs can wait for the
+// events to reach the API server before exiting (see Flush).
+type Recorder struct {
+	record.EventRecorder
+
+	broadcaster record.EventBroadcaster
+	recorded    int64
+	written     int64
+}
+
+// New returns a `Recorder` writing the events with the specified
+// reporting controller (also used as the event source component).  Similar events
+// are aggregated and rate limited by the broadcaster correlator
+// (burst of 25 events per object, then one every 5 minutes).
+//
+// The scheme must know the types of the objects the events are about
+// (unstructured objects carry their own type information).
+func New(cs kubernetes.Interface, scheme *runtime.Scheme, reportingController string) *Recorder {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: 25,
+		QPS:       1. / 300.,
+	})
+
+	r := &Recorder{broadcaster: broadcaster}
+
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&sink{
+		EventSink:           &typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events("")},
+		reportingController: reportingController,
+		reportingInstance:   reportingInstance(reportingController),
+		written:             &r.written,
+	})
+
+	r.EventRecorder = broadcaster.NewRecorder(scheme, corev1.EventSource{
+		Component: reportingController,
+	})
+
+	return r
+}
+
+// Event records an event (see record.EventRecorder).
+func (r *Recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	atomic.AddInt64(&r.recorded, 1)
+	r.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+// Eventf records an event (see record.EventRecorder).
+func (r *Recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	atomic.AddInt64(&r.recorded, 1)
+	r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+// AnnotatedEventf records an event (see record.EventRecorder).
+func (r *Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	atomic.AddInt64(&r.recorded, 1)
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+}
+
+// Flush waits (at most for the specified timeout) until all the recorded
+// events have been written and then shuts down the broadcaster.  Events
+// dropped by the rate limiter are never written: in that case Flush
+// simply waits for the timeout.
+func (r *Recorder) Flush(timeout time.Duration) {
+	defer r.broadcaster.Shutdown()
+
+	_ = wait.PollImmediate(50*time.Millisecond, timeout, func() (bool, error) {
+		return atomic.LoadInt64(&r.written) >= atomic.LoadInt64(&r.recorded), nil
+	})
+}
+
+var _ record.EventRecorder = (*Recorder)(nil)
+
+// sink fills the reporting controller and instance of the events
+// (not set by record.EventRecorder) and counts the writes (successful
+// or not) of the nested sink.
+type sink struct {
+	record.EventSink
+	reportingController string
+	reportingInstance   string
+	written             *int64
+}
+
+func (s *sink) Create(event *corev1.Event) (*corev1.Event, error) {
+	defer atomic.AddInt64(s.written, 1)
+	return s.EventSink.Create(s.withReporter(event))
+}
+
+func (s *sink) Update(event *corev1.Event) (*corev1.Event, error) {
+	defer atomic.AddInt64(s.written, 1)
+	return s.EventSink.Update(s.withReporter(event))
+}
+
+func (s *sink) Patch(oldEvent *corev1.Event, data []byte) (*corev1.Event, error) {
+	defer atomic.AddInt64(s.written, 1)
+	return s.EventSink.Patch(oldEvent, data)
+}
+
+// withReporter sets the reporting controller and instance, if missing.
+func (s *sink) withReporter(event *corev1.Event) *corev1.Event {
+	if len(event.ReportingController) == 0 {
+		event.ReportingController = s.reportingController
+	}
+	if len(event.ReportingInstance) == 0 {
+		event.ReportingInstance = s.reportingInstance
+	}
+	return event
+}
+
+// reportingInstance returns the reporting controller
+// followed by the host name (i.e. pod-controller-myhost).
+func reportingInstance(reportingController string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		return reportingController
+	}
+	return fmt.Sprintf("%s-%s", reportingController, host)
+}
@@ -0,0 +1,116 @@
+package recorder
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// written collects the events created through a fake clientset
+type written struct {
+	mu     sync.Mutex
+	events []*corev1.Event
+}
+
+func (w *written) list() []*corev1.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*corev1.Event(nil), w.events...)
+}
+
+// newClientset returns a fake clientset recording the created
+// events, once the specified function returns
+func newClientset(wait func()) (*fake.Clientset, *written) {
+	w := &written{}
+
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		wait()
+
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.events = append(w.events, event.DeepCopy())
+
+		return true, event, nil
+	})
+
+	return cs, w
+}
+
+var pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx", UID: "uid-1"}}
+
+func TestFlushWaitsForTheEvents(t *testing.T) {
+	// slow API server
+	cs, w := newClientset(func() { time.Sleep(100 * time.Millisecond) })
+
+	rec := New(cs, scheme.Scheme, "pod-controller")
+	rec.Eventf(pod, corev1.EventTypeWarning, "Dropped", "Pod dropped after %d retries", 5)
+	rec.Event(pod, corev1.EventTypeNormal, "Labeled", "Policy applied")
+
+	rec.Flush(5 * time.Second)
+
+	events := w.list()
+	if len(events) != 2 {
+		t.Fatalf("got %d events written, expected 2", len(events))
+	}
+
+	for _, el := range events {
+		if el.ReportingController != "pod-controller" {
+			t.Errorf("got reportingController %q", el.ReportingController)
+		}
+		if !strings.HasPrefix(el.ReportingInstance, "pod-controller") {
+			t.Errorf("got reportingInstance %q", el.ReportingInstance)
+		}
+		if el.Source.Component != "pod-controller" {
+			t.Errorf("got source %q", el.Source.Component)
+		}
+		if el.InvolvedObject.Name != "nginx" || el.InvolvedObject.Kind != "Pod" {
+			t.Errorf("unexpected involved object %+v", el.InvolvedObject)
+		}
+	}
+
+	if got := events[0].Reason + ": " + events[0].Message; got != "Dropped: Pod dropped after 5 retries" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFlushWithoutEvents(t *testing.T) {
+	cs, _ := newClientset(func() {})
+
+	rec := New(cs, scheme.Scheme, "pod-controller")
+
+	start := time.Now()
+	rec.Flush(5 * time.Second)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("nothing to wait for, but Flush took %s", elapsed)
+	}
+}
+
+func TestFlushTimeout(t *testing.T) {
+	// the API server never answers (until the end of the test)
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	cs, _ := newClientset(func() { <-unblock })
+
+	rec := New(cs, scheme.Scheme, "pod-controller")
+	rec.Event(pod, corev1.EventTypeNormal, "Labeled", "Policy applied")
+
+	start := time.Now()
+	rec.Flush(200 * time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Flush took %s, expected to give up after 200ms", elapsed)
+	}
+}
@@ -0,0 +1,54 @@
+// Package resource resolves the resource names typed by a user (like
+// kubectl does) to the REST mappings used by the dynamic clients.
+package resource
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// NewMapper returns a RESTMapper backed by the discovery client (cached
+// in memory) that knows about the short names (i.e. deploy, exp) as well.
+func NewMapper(dc discovery.DiscoveryInterface) meta.RESTMapper {
+	return restmapper.NewShortcutExpander(
+		restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc)), dc)
+}
+
+// Resolve returns the REST mapping for a resource or kind name
+// like kubectl does: plural, singular and short names are all
+// accepted, optionally followed by the group (i.e. deploy.apps)
+// or by the version and the group (i.e. deployments.v1.apps).
+func Resolve(mapper meta.RESTMapper, arg string) (*meta.RESTMapping, error) {
+	fullySpecified, gr := schema.ParseResourceArg(strings.ToLower(arg))
+
+	// i.e. deployments.v1.apps: unless it is a group with dots
+	// (i.e. pizzas.bella.napoli.it), like kubectl does
+	var gvk schema.GroupVersionKind
+	if fullySpecified != nil {
+		gvk, _ = mapper.KindFor(*fullySpecified)
+	}
+	if gvk.Empty() {
+		var err error
+		if gvk, err = mapper.KindFor(gr.WithVersion("")); err != nil {
+			return nil, err
+		}
+	}
+
+	return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// DisplayName returns namespace/name for namespaced objects
+// and just the name for the cluster scoped ones.
+func DisplayName(obj metav1.Object) string {
+	if ns := obj.GetNamespace(); len(ns) > 0 {
+		return fmt.Sprintf("%s/%s", ns, obj.GetName())
+	}
+	return obj.GetName()
+}
@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newMapper returns a mapper knowing about a few resources
+func newMapper() meta.RESTMapper {
+	dc := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "pods", SingularName: "pod", Namespaced: true, Kind: "Pod", ShortNames: []string{"po"}, Verbs: []string{"list", "watch"}},
+					{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", ShortNames: []string{"ns"}, Verbs: []string{"list", "watch"}},
+				},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", SingularName: "deployment", Namespaced: true, Kind: "Deployment", ShortNames: []string{"deploy"}, Verbs: []string{"list", "watch"}},
+				},
+			},
+			{
+				GroupVersion: "bella.napoli.it/v1alpha1",
+				APIResources: []metav1.APIResource{
+					{Name: "pizzas", SingularName: "pizza", Namespaced: true, Kind: "Pizza", Verbs: []string{"list", "watch"}},
+				},
+			},
+		},
+	}}
+
+	return NewMapper(dc)
+}
+
+func TestResolve(t *testing.T) {
+	mapper := newMapper()
+
+	tests := map[string]string{
+		"pods":                   "/v1, Resource=pods",
+		"pod":                    "/v1, Resource=pods",
+		"po":                     "/v1, Resource=pods",
+		"Pod":                    "/v1, Resource=pods",
+		"ns":                     "/v1, Resource=namespaces",
+		"deploy":                 "apps/v1, Resource=deployments",
+		"deployments.apps":       "apps/v1, Resource=deployments",
+		"deployments.v1.apps":    "apps/v1, Resource=deployments",
+		"pizzas.bella.napoli.it": "bella.napoli.it/v1alpha1, Resource=pizzas",
+		"pizza":                  "bella.napoli.it/v1alpha1, Resource=pizzas",
+	}
+
+	for arg, expected := range tests {
+		mapping, err := Resolve(mapper, arg)
+		if err != nil {
+			t.Errorf("%s: %v", arg, err)
+			continue
+		}
+		if got := mapping.Resource.String(); got != expected {
+			t.Errorf("%s: got %s, expected %s", arg, got, expected)
+		}
+	}
+}
+
+func TestResolveScope(t *testing.T) {
+	mapper := newMapper()
+
+	for arg, expected := range map[string]meta.RESTScopeName{
+		"pods":       meta.RESTScopeNameNamespace,
+		"namespaces": meta.RESTScopeNameRoot,
+	} {
+		mapping, err := Resolve(mapper, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mapping.Scope.Name(); got != expected {
+			t.Errorf("%s: got scope %s, expected %s", arg, got, expected)
+		}
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	if _, err := Resolve(newMapper(), "widgets"); err == nil {
+		t.Fatal("expected an error for an unknown resource")
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetName("nginx")
+
+	if got := DisplayName(obj); got != "nginx" {
+		t.Fatalf("got %q, expected %q", got, "nginx")
+	}
+
+	obj.SetNamespace("default")
+	if got := DisplayName(obj); got != "default/nginx" {
+		t.Fatalf("got %q, expected %q", got, "default/nginx")
+	}
+}
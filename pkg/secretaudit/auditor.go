@@ -0,0 +1,120 @@
+package secretaudit
+
+import (
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/handler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// Auditor is a cache.ResourceEventHandler for Secrets writing the real
+// changes to a Log.
+//
+// The informer notifies an update on every resync too: updates with
+// the same resourceVersion are ignored, as well as the ones that do not
+// touch the keys (i.e. labels).  At startup the informer notifies every
+// existing Secret as added: the ones created before the Auditor are
+// ignored (the creation timestamp has a one second resolution).
+type Auditor struct {
+	log     *Log
+	key     []byte
+	started time.Time
+
+	// OnRecord, if not nil, is called for each record written.
+	OnRecord func(Record)
+}
+
+// NewAuditor returns an `Auditor` writing to the log; the values are
+// fingerprinted with the HMAC key (i.e. 32 random bytes), which
+// must not be empty.
+func NewAuditor(log *Log, key []byte) (*Auditor, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+
+	return &Auditor{
+		log:     log,
+		key:     key,
+		started: time.Now().Truncate(time.Second),
+	}, nil
+}
+
+// OnAdd records the creation of a Secret.
+func (a *Auditor) OnAdd(obj interface{}) {
+	secret, ok := handler.As[*corev1.Secret](obj)
+	if !ok {
+		return
+	}
+
+	// already there when we started
+	if secret.CreationTimestamp.Time.Before(a.started) {
+		return
+	}
+
+	a.write(Created, secret, Compare(a.key, nil, secret))
+}
+
+// OnUpdate records the changes to the keys of a Secret.
+func (a *Auditor) OnUpdate(oldObj, newObj interface{}) {
+	old, ok := handler.As[*corev1.Secret](oldObj)
+	if !ok {
+		return
+	}
+	secret, ok := handler.As[*corev1.Secret](newObj)
+	if !ok {
+		return
+	}
+
+	// resync: nothing changed
+	if old.ResourceVersion == secret.ResourceVersion {
+		return
+	}
+
+	keys := Compare(a.key, old, secret)
+	if len(keys) == 0 {
+		return
+	}
+
+	a.write(Updated, secret, keys)
+}
+
+// OnDelete records the deletion of a Secret; when the informer missed
+// the deletion, the last known state is in a tombstone.
+func (a *Auditor) OnDelete(obj interface{}) {
+	secret, ok := handler.As[*corev1.Secret](obj)
+	if !ok {
+		return
+	}
+
+	a.write(Deleted, secret, Compare(a.key, secret, nil))
+}
+
+var _ cache.ResourceEventHandler = (*Auditor)(nil)
+
+func (a *Auditor) write(action Action, secret *corev1.Secret, keys []KeyChange) {
+	rec := Record{
+		Time:            time.Now().UTC(),
+		Action:          action,
+		Namespace:       secret.Namespace,
+		Name:            secret.Name,
+		UID:             string(secret.UID),
+		ResourceVersion: secret.ResourceVersion,
+		Keys:            keys,
+	}
+
+	// the deleter is not in the managedFields of the last known state
+	if action != Deleted {
+		rec.ChangedBy = ChangedBy(secret)
+	}
+
+	if err := a.log.Write(rec); err != nil {
+		klog.ErrorS(err, "Writing audit record failed", "secret", klog.KObj(secret))
+		return
+	}
+
+	if a.OnRecord != nil {
+		a.OnRecord(rec)
+	}
+}
@@ -0,0 +1,130 @@
+package secretaudit
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newAuditor returns an Auditor collecting the records it writes
+func newAuditor(t *testing.T) (*Auditor, *[]Record) {
+	t.Helper()
+
+	log, err := NewLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	a, err := NewAuditor(log, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []Record
+	a.OnRecord = func(rec Record) { records = append(records, rec) }
+
+	return a, &records
+}
+
+// written returns a secret written by the manager now, at the resourceVersion
+func written(manager, rv string, data map[string]string) *corev1.Secret {
+	now := metav1.Now()
+
+	res := secret(data)
+	res.UID = "uid-1"
+	res.ResourceVersion = rv
+	res.CreationTimestamp = now
+	res.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: manager, Operation: metav1.ManagedFieldsOperationUpdate, Time: &now},
+	}
+	return res
+}
+
+func TestNewAuditorWithoutKey(t *testing.T) {
+	if _, err := NewAuditor(nil, nil); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("got %v, expected ErrNoKey", err)
+	}
+}
+
+func TestAuditorRecordsWhoChangedWhat(t *testing.T) {
+	a, records := newAuditor(t)
+
+	created := written("kubectl-create", "1", map[string]string{"password": "hunter2"})
+	a.OnAdd(created)
+
+	updated := written("vault", "2", map[string]string{"password": "hunter3"})
+	a.OnUpdate(created, updated)
+
+	a.OnDelete(updated)
+
+	if len(*records) != 3 {
+		t.Fatalf("got %d records, expected 3", len(*records))
+	}
+
+	got := make([]string, 0, 3)
+	for _, el := range *records {
+		got = append(got, string(el.Action)+" "+el.ResourceVersion)
+	}
+	if expected := []string{"created 1", "updated 2", "deleted 2"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+
+	if got := (*records)[0].ChangedBy; !reflect.DeepEqual(got, []string{"kubectl-create (Update)"}) {
+		t.Fatalf("created by %q", got)
+	}
+	if got := (*records)[1].ChangedBy; !reflect.DeepEqual(got, []string{"vault (Update)"}) {
+		t.Fatalf("updated by %q", got)
+	}
+	// the deleter is unknown
+	if got := (*records)[2].ChangedBy; len(got) != 0 {
+		t.Fatalf("deleted by %q, expected no one", got)
+	}
+
+	keys := (*records)[1].Keys
+	if len(keys) != 1 || keys[0].Op != KeyChanged || keys[0].NewHash != Fingerprint(testKey, []byte("hunter3")) {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+}
+
+func TestAuditorIgnoresNonChanges(t *testing.T) {
+	a, records := newAuditor(t)
+
+	// existing before the auditor
+	old := written("kubectl-create", "1", map[string]string{"password": "hunter2"})
+	old.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	a.OnAdd(old)
+
+	// resync
+	a.OnUpdate(old, old)
+
+	// labels only
+	labeled := old.DeepCopy()
+	labeled.ResourceVersion = "2"
+	labeled.Labels = map[string]string{"app": "db"}
+	a.OnUpdate(old, labeled)
+
+	// not a secret
+	a.OnAdd(&corev1.ConfigMap{})
+
+	if len(*records) != 0 {
+		t.Fatalf("unexpected records %+v", *records)
+	}
+}
+
+func TestAuditorTombstone(t *testing.T) {
+	a, records := newAuditor(t)
+
+	last := written("kubectl-create", "1", map[string]string{"password": "hunter2"})
+	a.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/db", Obj: last})
+
+	if len(*records) != 1 || (*records)[0].Action != Deleted || len((*records)[0].Keys) != 1 {
+		t.Fatalf("unexpected records %+v", *records)
+	}
+}
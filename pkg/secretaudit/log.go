@@ -0,0 +1,124 @@
+package secretaudit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Log is an append-only JSON-lines file; when it grows beyond
+// the maximum size it is rotated: `audit.jsonl` is renamed to
+// `audit.jsonl.1`, the former `audit.jsonl.1` to `audit.jsonl.2` and
+// so on, keeping at most the specified number of backups.
+type Log struct {
+	filename   string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewLog opens (or creates) the log file; maxBytes <= 0 disables rotation.
+func NewLog(filename string, maxBytes int64, maxBackups int) (*Log, error) {
+	l := &Log{
+		filename:   filename,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Write appends the record as a JSON line.
+func (l *Log) Write(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log %s is closed", l.filename)
+	}
+
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// open opens the log file in append mode (no one else can read it:
+// even if the values are not there, the key names may be sensitive).
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file, l.size = f, fi.Size()
+	return nil
+}
+
+// rotate shifts the backups, dropping the oldest one, and starts
+// a new file; the caller must hold the lock.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.maxBackups <= 0 {
+		if err := os.Remove(l.filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return l.open()
+	}
+
+	for i := l.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", l.filename, i), fmt.Sprintf("%s.%d", l.filename, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(l.filename, l.filename+".1"); err != nil {
+		return err
+	}
+
+	return l.open()
+}
@@ -0,0 +1,158 @@
+package secretaudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readLog returns the names of the secrets recorded in a log file
+func readLog(t *testing.T, filename string) []string {
+	t.Helper()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var res []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		res = append(res, rec.Name)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// recordSize returns the size of a record line
+func recordSize(t *testing.T, rec Record) int64 {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data) + 1)
+}
+
+func TestLogAppends(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	log, err := NewLog(filename, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Write(Record{Action: Created, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopened: appended to
+	log, err = NewLog(filename, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if err := log.Write(Record{Action: Updated, Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readLog(t, filename); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("got %q, expected [a b]", got)
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("got permissions %v, expected 0600", perm)
+	}
+}
+
+func TestLogRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// two records per file
+	size := recordSize(t, Record{Action: Created, Name: "0"})
+	log, err := NewLog(filename, 2*size, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	for _, name := range []string{"0", "1", "2", "3", "4", "5", "6"} {
+		if err := log.Write(Record{Action: Created, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string][]string{
+		filename:        {"6"},
+		filename + ".1": {"4", "5"},
+		filename + ".2": {"2", "3"},
+	}
+	for fn, names := range expected {
+		if got := readLog(t, fn); !reflect.DeepEqual(got, names) {
+			t.Errorf("%s: got %q, expected %q", filepath.Base(fn), got, names)
+		}
+	}
+
+	// the oldest backup is dropped
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected third backup: %v", err)
+	}
+}
+
+func TestLogRotationWithoutBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	size := recordSize(t, Record{Action: Created, Name: "0"})
+	log, err := NewLog(filename, size, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	for _, name := range []string{"0", "1", "2"} {
+		if err := log.Write(Record{Action: Created, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readLog(t, filename); len(got) != 1 || got[0] != "2" {
+		t.Fatalf("got %q, expected [2]", got)
+	}
+	if _, err := os.Stat(filename + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected backup: %v", err)
+	}
+}
+
+func TestLogClosed(t *testing.T) {
+	log, err := NewLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Write(Record{Name: "a"}); err == nil {
+		t.Fatal("expected an error writing to a closed log")
+	}
+	// closing twice is fine
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+// Package secretaudit keeps an audit trail of the changes to Secrets.
+//
+// The Auditor is an informer event handler: for each real change (resyncs
+// and metadata only updates are ignored) it writes to a JSON-lines Log
+// which keys were added, removed or changed, and who changed them
+// (according to managedFields).  Values are never recorded: only their
+// HMAC-SHA256 fingerprints, enough to tell whether two values are the
+// same.  The HMAC key is supplied by the operator and must be kept as
+// secret as the Secrets themselves: without it, the fingerprints of low
+// entropy values (i.e. passwords) cannot be brute-forced.
+package secretaudit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Action is what happened to the Secret.
+type Action string
+
+const (
+	Created Action = "created"
+	Updated Action = "updated"
+	Deleted Action = "deleted"
+)
+
+// KeyOperation is what happened to a key of the Secret.
+type KeyOperation string
+
+const (
+	KeyAdded   KeyOperation = "added"
+	KeyRemoved KeyOperation = "removed"
+	KeyChanged KeyOperation = "changed"
+)
+
+// KeyChange describes the change of a key; the hashes (the values
+// fingerprints) are empty when the key did not (or does not anymore) exist.
+type KeyChange struct {
+	Key     string       `json:"key"`
+	Op      KeyOperation `json:"op"`
+	OldHash string       `json:"oldHash,omitempty"`
+	NewHash string       `json:"newHash,omitempty"`
+}
+
+// Record is an entry of the audit log.
+type Record struct {
+	Time            time.Time   `json:"time"`
+	Action          Action      `json:"action"`
+	Namespace       string      `json:"namespace"`
+	Name            string      `json:"name"`
+	UID             string      `json:"uid,omitempty"`
+	ResourceVersion string      `json:"resourceVersion"`
+	Keys            []KeyChange `json:"keys,omitempty"`
+	// ChangedBy are the field managers of the most recent write.
+	ChangedBy []string `json:"changedBy,omitempty"`
+}
+
+// ErrNoKey is returned when no HMAC key is supplied.
+var ErrNoKey = errors.New("the HMAC key of the values fingerprints is empty")
+
+// Compare returns the changes of the keys between two versions of a
+// Secret, fingerprinting the values with the HMAC key; old or new can
+// be nil (the Secret was created or deleted).
+func Compare(key []byte, old, new *corev1.Secret) []KeyChange {
+	oldHashes, newHashes := hashes(key, old), hashes(key, new)
+
+	var res []KeyChange
+	for k, nh := range newHashes {
+		oh, ok := oldHashes[k]
+		switch {
+		case !ok:
+			res = append(res, KeyChange{Key: k, Op: KeyAdded, NewHash: nh})
+		case oh != nh:
+			res = append(res, KeyChange{Key: k, Op: KeyChanged, OldHash: oh, NewHash: nh})
+		}
+	}
+	for k, oh := range oldHashes {
+		if _, ok := newHashes[k]; !ok {
+			res = append(res, KeyChange{Key: k, Op: KeyRemoved, OldHash: oh})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+
+	return res
+}
+
+// ChangedBy returns the field managers of the most recent write,
+// as "manager (operation)"; the managers writing only the status
+// subresource are not interesting and are skipped.
+func ChangedBy(obj metav1.Object) []string {
+	var latest *metav1.Time
+	for _, el := range obj.GetManagedFields() {
+		if el.Time != nil && (latest == nil || latest.Before(el.Time)) {
+			latest = el.Time
+		}
+	}
+
+	var res []string
+	for _, el := range obj.GetManagedFields() {
+		if len(el.Subresource) > 0 {
+			continue
+		}
+		if latest != nil && (el.Time == nil || !el.Time.Equal(latest)) {
+			continue
+		}
+		res = append(res, el.Manager+" ("+string(el.Operation)+")")
+	}
+
+	return res
+}
+
+// Fingerprint returns the hex encoded HMAC-SHA256 of a value:
+// unlike a plain hash, it cannot be reversed by brute force
+// without the key.
+func Fingerprint(key, value []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(value)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashes returns the fingerprints of the values of the Secret keys;
+// stringData is write only, so the API server returns only data.
+func hashes(key []byte, secret *corev1.Secret) map[string]string {
+	res := map[string]string{}
+	if secret == nil {
+		return res
+	}
+
+	for k, v := range secret.Data {
+		res[k] = Fingerprint(key, v)
+	}
+	for k, v := range secret.StringData {
+		res[k] = Fingerprint(key, []byte(v))
+	}
+
+	return res
+}
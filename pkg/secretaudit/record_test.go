@@ -0,0 +1,126 @@
+package secretaudit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func secret(data map[string]string) *corev1.Secret {
+	res := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		res.Data[k] = []byte(v)
+	}
+	return res
+}
+
+func TestFingerprint(t *testing.T) {
+	fp := Fingerprint(testKey, []byte("hunter2"))
+
+	if !strings.HasPrefix(fp, "hmac-sha256:") {
+		t.Fatalf("unexpected fingerprint %q", fp)
+	}
+	if got := Fingerprint(testKey, []byte("hunter2")); got != fp {
+		t.Fatalf("the same value has two fingerprints: %q, %q", fp, got)
+	}
+	if got := Fingerprint(testKey, []byte("hunter3")); got == fp {
+		t.Fatal("two values have the same fingerprint")
+	}
+
+	// without the key, it cannot be matched against a dictionary
+	if got := Fingerprint([]byte("another key"), []byte("hunter2")); got == fp {
+		t.Fatal("the fingerprint does not depend on the key")
+	}
+	sum := sha256.Sum256([]byte("hunter2"))
+	if strings.HasSuffix(fp, hex.EncodeToString(sum[:])) {
+		t.Fatal("the fingerprint is the plain SHA-256")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	fp := func(v string) string { return Fingerprint(testKey, []byte(v)) }
+
+	tests := map[string]struct {
+		old, new *corev1.Secret
+		expected []KeyChange
+	}{
+		"created": {
+			new: secret(map[string]string{"user": "admin", "password": "hunter2"}),
+			expected: []KeyChange{
+				{Key: "password", Op: KeyAdded, NewHash: fp("hunter2")},
+				{Key: "user", Op: KeyAdded, NewHash: fp("admin")},
+			},
+		},
+		"deleted": {
+			old: secret(map[string]string{"password": "hunter2"}),
+			expected: []KeyChange{
+				{Key: "password", Op: KeyRemoved, OldHash: fp("hunter2")},
+			},
+		},
+		"updated": {
+			old: secret(map[string]string{"user": "admin", "password": "hunter2", "token": "abc"}),
+			new: secret(map[string]string{"user": "admin", "password": "hunter3", "host": "db"}),
+			expected: []KeyChange{
+				{Key: "host", Op: KeyAdded, NewHash: fp("db")},
+				{Key: "password", Op: KeyChanged, OldHash: fp("hunter2"), NewHash: fp("hunter3")},
+				{Key: "token", Op: KeyRemoved, OldHash: fp("abc")},
+			},
+		},
+		"unchanged": {
+			old: secret(map[string]string{"user": "admin"}),
+			new: secret(map[string]string{"user": "admin"}),
+		},
+	}
+
+	for name, tc := range tests {
+		got := Compare(testKey, tc.old, tc.new)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %+v, expected %+v", name, got, tc.expected)
+		}
+	}
+}
+
+func TestCompareStringData(t *testing.T) {
+	old := secret(map[string]string{"password": "hunter2"})
+	new := &corev1.Secret{StringData: map[string]string{"password": "hunter2"}}
+
+	if got := Compare(testKey, old, new); len(got) != 0 {
+		t.Fatalf("the same value in stringData is a change: %+v", got)
+	}
+}
+
+func TestChangedBy(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(earlier.Add(time.Minute))
+
+	obj := secret(nil)
+	obj.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-create", Operation: metav1.ManagedFieldsOperationUpdate, Time: &earlier},
+		{Manager: "kubectl-client-side-apply", Operation: metav1.ManagedFieldsOperationUpdate, Time: &later},
+		{Manager: "vault", Operation: metav1.ManagedFieldsOperationApply, Time: &later},
+		// status writers are skipped
+		{Manager: "kubelet", Operation: metav1.ManagedFieldsOperationUpdate, Time: &later, Subresource: "status"},
+	}
+
+	expected := []string{"kubectl-client-side-apply (Update)", "vault (Apply)"}
+	if got := ChangedBy(obj); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+
+	// stripped managedFields: no one to blame
+	obj.ManagedFields = nil
+	if got := ChangedBy(obj); len(got) != 0 {
+		t.Fatalf("got %q, expected none", got)
+	}
+}
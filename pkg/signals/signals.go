@@ -0,0 +1,43 @@
+// Package signals turns SIGINT (CTRL+C) and SIGTERM (kubectl delete
+// pod) into the cancellation of a context, so the long running examples
+// can stop their informers and drain their queues before exiting.
+package signals
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+// ExitDrainTimeout is the exit code used when the shutdown
+// did not complete in time (i.e. the queue was not drained).
+const ExitDrainTimeout = 2
+
+// Context returns a context canceled on the first SIGINT or SIGTERM:
+// a second signal exits immediately (the shutdown is taking too long).
+func Context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			klog.InfoS("Shutting down, send the signal again to force the exit", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(sigCh)
+			return
+		}
+
+		sig := <-sigCh
+		klog.InfoS("Forced exit", "signal", sig)
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
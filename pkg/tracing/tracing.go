@@ -0,0 +1,224 @@
+// Package tracing provides an http.RoundTripper that creates an
+// OpenTelemetry span for each API request made by a client-go client.
+//
+// Plug it in using the rest.Config WrapTransport hook:
+//
+//	rc.WrapTransport = tracing.Wrap(tracerProvider)
+//
+// and pass a context.Context carrying the caller span to the client
+// methods (i.e. `Get(ctx, ...)`) to have the request spans as children.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the tracer used by Transport.
+const InstrumentationName = "github.com/lucasepe/using-client-go/pkg/tracing"
+
+const (
+	// ResendCountKey is the attribute holding the number of times
+	// this same request has already been attempted (retries).
+	ResendCountKey = attribute.Key("http.resend_count")
+	// WatchKey is the attribute telling if the request is a watch.
+	WatchKey = attribute.Key("k8s.watch")
+)
+
+// attemptKey identifies the attempts of the same request made by the
+// client-go retry logic: same caller context, same method and same URL.
+type attemptKey struct {
+	ctx    context.Context
+	method string
+	url    string
+}
+
+// attempt is the history of a request.
+type attempt struct {
+	count int
+	last  time.Time
+}
+
+// maxAttempts bounds the number of requests whose history is kept:
+// a request is forgotten when its last response does not ask for a
+// retry, but client-go gives up after a maximum number of retries and
+// the caller context could be never canceled.
+var maxAttempts = 1024
+
+// Transport implements http.RoundTripper.  It starts a client span before
+// calling the nested RoundTripper and ends it as soon as the response
+// headers (or an error) are received.
+type Transport struct {
+	http.RoundTripper
+
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	mu       sync.Mutex
+	attempts map[attemptKey]attempt
+}
+
+// NewTransport returns a new `Transport` wrapping the given RoundTripper.
+// Spans are created by the given TracerProvider and their context is
+// injected in the outgoing request headers using the given propagator.
+func NewTransport(rt http.RoundTripper, tp trace.TracerProvider, prop propagation.TextMapPropagator) *Transport {
+	return &Transport{
+		RoundTripper: rt,
+		tracer:       tp.Tracer(InstrumentationName),
+		propagator:   prop,
+		attempts:     map[attemptKey]attempt{},
+	}
+}
+
+// Wrap returns a function suitable for the rest.Config WrapTransport field.
+// The span context is propagated using the W3C Trace Context headers.
+func Wrap(tp trace.TracerProvider) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return NewTransport(rt, tp, propagation.TraceContext{})
+	}
+}
+
+// RoundTrip creates a span for the request and calls the nested RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	template := URLTemplate(req.URL.Path)
+	watching := req.URL.Query().Get("watch") == "true"
+
+	key := attemptKey{req.Context(), req.Method, req.URL.String()}
+	resends := t.nextAttempt(key)
+
+	ctx, span := t.tracer.Start(req.Context(),
+		fmt.Sprintf("%s %s", req.Method, template),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(fmt.Sprintf("%s://%s%s", req.URL.Scheme, req.URL.Host, template)),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+			WatchKey.Bool(watching),
+			ResendCountKey.Int(resends),
+		),
+	)
+	defer span.End()
+
+	// never modify the caller's request
+	req = req.Clone(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		t.doneAttempt(key, true)
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+
+	// client-go retries only when the server asks it to
+	t.doneAttempt(key, len(resp.Header.Get("Retry-After")) > 0)
+
+	return resp, nil
+}
+
+// nextAttempt returns how many times the request has already been sent.
+func (t *Transport) nextAttempt(key attemptKey) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	el, ok := t.attempts[key]
+	if !ok && len(t.attempts) >= maxAttempts {
+		t.evict()
+	}
+
+	t.attempts[key] = attempt{count: el.count + 1, last: time.Now()}
+	return el.count
+}
+
+// evict forgets the requests whose context is done or, if
+// none, the request with the oldest attempt (t.mu is held).
+func (t *Transport) evict() {
+	var (
+		oldest attemptKey
+		found  bool
+	)
+
+	for key, el := range t.attempts {
+		if key.ctx.Err() != nil {
+			delete(t.attempts, key)
+			continue
+		}
+		if !found || el.last.Before(t.attempts[oldest].last) {
+			oldest, found = key, true
+		}
+	}
+
+	if found && len(t.attempts) >= maxAttempts {
+		delete(t.attempts, oldest)
+	}
+}
+
+// doneAttempt forgets the attempts history of a request
+// unless it is going to be retried by client-go.
+func (t *Transport) doneAttempt(key attemptKey, retriable bool) {
+	if retriable && key.ctx.Err() == nil {
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.attempts, key)
+	t.mu.Unlock()
+}
+
+// URLTemplate returns the specified API path with namespace
+// and object names replaced by placeholders, so that spans for
+// different objects of the same resource share the same name.
+//
+//	/api/v1/namespaces/default/pods/nginx/log => /api/v1/namespaces/{namespace}/pods/{name}/log
+func URLTemplate(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	// skip the group version prefix: /api/v1 or /apis/group/version
+	var prefix int
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		prefix = 2
+	case len(parts) >= 3 && parts[0] == "apis":
+		prefix = 3
+	default:
+		// not a resource path (i.e. /version, /openapi/v2)
+		return path
+	}
+
+	rest := parts[prefix:]
+
+	// namespaced resources: namespaces/{namespace}/{resource}/...
+	if len(rest) >= 3 && rest[0] == "namespaces" && !isNamespaceSubresource(rest[2]) {
+		rest[1] = "{namespace}"
+		rest = rest[2:]
+	}
+
+	// {resource}/{name}/{subresource}
+	if len(rest) >= 2 {
+		rest[1] = "{name}"
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// isNamespaceSubresource returns true for the subresources
+// of the namespace object itself (i.e. namespaces/foo/status).
+func isNamespaceSubresource(s string) bool {
+	return s == "status" || s == "finalize"
+}
@@ -0,0 +1,265 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// apiServer answers with the responses returned by the specified
+// function and remembers the traceparent header of each request
+type apiServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	traceparents []string
+}
+
+func newAPIServer(t *testing.T, fn func(w http.ResponseWriter, r *http.Request)) *apiServer {
+	t.Helper()
+
+	srv := &apiServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.traceparents = append(srv.traceparents, r.Header.Get("traceparent"))
+		srv.mu.Unlock()
+
+		fn(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// writePod answers with a pod named after the last path segment
+func writePod(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+	})
+}
+
+// newClient returns a clientset for the server, tracing its requests
+func newClient(t *testing.T, srv *apiServer) (*kubernetes.Clientset, *Transport, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	var transport *Transport
+	cs, err := kubernetes.NewForConfig(&rest.Config{
+		Host: srv.URL,
+		// no client side throttling of the retries
+		QPS: -1,
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			transport = NewTransport(rt, tp, propagation.TraceContext{})
+			return transport
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cs, transport, exporter, tp
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSpanNamesUseTheURLTemplate(t *testing.T) {
+	srv := newAPIServer(t, writePod)
+	cs, _, exporter, _ := newClient(t, srv)
+
+	for _, name := range []string{"nginx", "redis"} {
+		if _, err := cs.CoreV1().Pods("default").Get(context.TODO(), name, metav1.GetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, expected 2", len(spans))
+	}
+
+	for _, el := range spans {
+		if expected := "GET /api/v1/namespaces/{namespace}/pods/{name}"; el.Name != expected {
+			t.Fatalf("got span %q, expected %q", el.Name, expected)
+		}
+		if got := attr(el, "http.status_code").AsInt64(); got != http.StatusOK {
+			t.Fatalf("got status code %d, expected 200", got)
+		}
+		if got := attr(el, WatchKey).AsBool(); got {
+			t.Fatal("a Get is not a watch")
+		}
+	}
+}
+
+func TestParentContextPropagation(t *testing.T) {
+	srv := newAPIServer(t, writePod)
+	cs, _, exporter, tp := newClient(t, srv)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := cs.CoreV1().Pods("default").Get(ctx, "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, expected 2", len(spans))
+	}
+
+	child := spans[0]
+	if child.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("got parent %s, expected %s", child.Parent.SpanID(), parent.SpanContext().SpanID())
+	}
+	if child.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatal("the request span belongs to another trace")
+	}
+
+	// the server receives the request span context
+	expected := "00-" + child.SpanContext.TraceID().String() + "-" + child.SpanContext.SpanID().String() + "-01"
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if got := srv.traceparents[0]; got != expected {
+		t.Fatalf("got traceparent %q, expected %q", got, expected)
+	}
+}
+
+func TestResendCount(t *testing.T) {
+	var calls int32
+	srv := newAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writePod(w, r)
+	})
+	cs, transport, exporter, _ := newClient(t, srv)
+
+	if _, err := cs.CoreV1().Pods("default").Get(context.TODO(), "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, expected 3", len(spans))
+	}
+	for i, el := range spans {
+		if got := attr(el, ResendCountKey).AsInt64(); got != int64(i) {
+			t.Fatalf("span %d: got resend count %d, expected %d", i, got, i)
+		}
+	}
+	if spans[0].Status.Code != codes.Error || spans[2].Status.Code != codes.Unset {
+		t.Fatalf("unexpected statuses %v, %v", spans[0].Status, spans[2].Status)
+	}
+
+	// the request succeeded: its history is forgotten
+	if got := len(transport.attempts); got != 0 {
+		t.Fatalf("got %d requests in the history, expected none", got)
+	}
+
+	// a new request starts from zero
+	if _, err := cs.CoreV1().Pods("default").Get(context.TODO(), "nginx", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := attr(exporter.GetSpans()[3], ResendCountKey).AsInt64(); got != 0 {
+		t.Fatalf("got resend count %d, expected 0", got)
+	}
+}
+
+func TestAttemptsAreBounded(t *testing.T) {
+	defer func(n int) { maxAttempts = n }(maxAttempts)
+	maxAttempts = 2
+
+	// always asks for a retry: client-go gives up after maxRetries
+	srv := newAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	cs, transport, exporter, _ := newClient(t, srv)
+
+	type key struct{}
+
+	for i := 0; i < 5; i++ {
+		// never canceled
+		ctx := context.WithValue(context.Background(), key{}, i)
+		if _, err := cs.CoreV1().Pods("default").Get(ctx, "nginx", metav1.GetOptions{}); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if got := len(transport.attempts); got > maxAttempts {
+			t.Fatalf("got %d requests in the history, expected at most %d", got, maxAttempts)
+		}
+	}
+
+	// the retries of each request are still counted
+	spans := exporter.GetSpans()
+	if got := attr(spans[len(spans)-1], ResendCountKey).AsInt64(); got == 0 {
+		t.Fatal("the retries of the last request were not counted")
+	}
+}
+
+func TestCanceledRequestsAreEvicted(t *testing.T) {
+	defer func(n int) { maxAttempts = n }(maxAttempts)
+	maxAttempts = 2
+
+	tr := NewTransport(http.DefaultTransport, sdktrace.NewTracerProvider(), propagation.TraceContext{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tr.nextAttempt(attemptKey{ctx, http.MethodGet, "/a"})
+	tr.nextAttempt(attemptKey{context.Background(), http.MethodGet, "/b"})
+	cancel()
+
+	// the canceled one makes room, "/b" is kept
+	tr.nextAttempt(attemptKey{context.Background(), http.MethodGet, "/c"})
+
+	if _, ok := tr.attempts[attemptKey{context.Background(), http.MethodGet, "/b"}]; !ok || len(tr.attempts) != 2 {
+		t.Fatalf("unexpected history %v", tr.attempts)
+	}
+}
+
+func TestURLTemplate(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/namespaces/default/pods/nginx/log":             "/api/v1/namespaces/{namespace}/pods/{name}/log",
+		"/api/v1/namespaces/default/pods":                       "/api/v1/namespaces/{namespace}/pods",
+		"/api/v1/namespaces/default":                            "/api/v1/namespaces/{name}",
+		"/api/v1/namespaces/default/status":                     "/api/v1/namespaces/{name}/status",
+		"/apis/apps/v1/namespaces/kube-system/deployments/dns":  "/apis/apps/v1/namespaces/{namespace}/deployments/{name}",
+		"/apis/rbac.authorization.k8s.io/v1/clusterroles/admin": "/apis/rbac.authorization.k8s.io/v1/clusterroles/{name}",
+		"/api/v1/nodes": "/api/v1/nodes",
+		"/version":      "/version",
+	}
+
+	for path, expected := range tests {
+		if got := URLTemplate(path); got != expected {
+			t.Errorf("%s: got %q, expected %q", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package transform trims the objects before they are stored in the
+// informer caches, to save memory: the managedFields, the last applied
+// configuration and, for some kinds, large fields nobody reads.
+//
+// client-go v0.23 has cache.TransformFunc but the shared informers
+// cannot use it yet: ListWatch applies the transformation to the
+// objects returned by a cache.ListerWatcher instead, so the informers
+// (shared or not) store the trimmed objects only.
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LastAppliedAnnotation is the (often large) annotation used by kubectl apply.
+const LastAppliedAnnotation = corev1.LastAppliedConfigAnnotation
+
+// Chain returns a TransformFunc applying the functions in order.
+func Chain(fns ...cache.TransformFunc) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		var err error
+		for _, fn := range fns {
+			if obj, err = fn(obj); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+}
+
+// StripManagedFields removes the managedFields of any object.
+func StripManagedFields() cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		if acc, err := meta.Accessor(obj); err == nil {
+			acc.SetManagedFields(nil)
+		}
+		return obj, nil
+	}
+}
+
+// DropAnnotations removes the annotations starting with any of the
+// prefixes (i.e. LastAppliedAnnotation or "kubectl.kubernetes.io/").
+func DropAnnotations(prefixes ...string) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		acc, err := meta.Accessor(obj)
+		if err != nil {
+			return obj, nil
+		}
+
+		annotations := acc.GetAnnotations()
+		for k := range annotations {
+			for _, el := range prefixes {
+				if strings.HasPrefix(k, el) {
+					delete(annotations, k)
+					break
+				}
+			}
+		}
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		acc.SetAnnotations(annotations)
+
+		return obj, nil
+	}
+}
+
+// DropSecretData removes the values of the Secrets (the keys are
+// kept, with empty values); other objects are left untouched.
+func DropSecretData() cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		if secret, ok := obj.(*corev1.Secret); ok {
+			for k := range secret.Data {
+				secret.Data[k] = nil
+			}
+			secret.StringData = nil
+		}
+		return obj, nil
+	}
+}
+
+// TrimPodStatus keeps only the phase, the conditions and the IPs
+// of the Pods status; other objects are left untouched.
+func TrimPodStatus() cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pod.Status = corev1.PodStatus{
+				Phase:      pod.Status.Phase,
+				Conditions: pod.Status.Conditions,
+				HostIP:     pod.Status.HostIP,
+				PodIP:      pod.Status.PodIP,
+				PodIPs:     pod.Status.PodIPs,
+				StartTime:  pod.Status.StartTime,
+			}
+		}
+		return obj, nil
+	}
+}
+
+// Parse returns the chain of the transformations named in the comma
+// separated list: managed-fields, last-applied, secret-data, pod-status.
+func Parse(names string) (cache.TransformFunc, error) {
+	var fns []cache.TransformFunc
+	for _, el := range strings.Split(names, ",") {
+		switch strings.TrimSpace(el) {
+		case "":
+		case "managed-fields":
+			fns = append(fns, StripManagedFields())
+		case "last-applied":
+			fns = append(fns, DropAnnotations(LastAppliedAnnotation))
+		case "secret-data":
+			fns = append(fns, DropSecretData())
+		case "pod-status":
+			fns = append(fns, TrimPodStatus())
+		default:
+			return nil, fmt.Errorf("unknown transformation %q", el)
+		}
+	}
+	return Chain(fns...), nil
+}
+
+// ListWatch returns a cache.ListerWatcher applying the transformation
+// to the items of the lists and to the objects of the watch events.
+func ListWatch(lw cache.ListerWatcher, fn cache.TransformFunc) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := lw.List(options)
+			if err != nil {
+				return nil, err
+			}
+
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, el := range items {
+				res, err := fn(el)
+				if err != nil {
+					return nil, err
+				}
+				if items[i], err = toObject(res); err != nil {
+					return nil, err
+				}
+			}
+
+			return list, meta.SetList(list, items)
+		},
+
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.Watch(options)
+			if err != nil {
+				return nil, err
+			}
+
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				// errors carry a metav1.Status
+				if event.Type == watch.Error {
+					return event, true
+				}
+
+				res, err := fn(event.Object)
+				if err == nil {
+					event.Object, err = toObject(res)
+				}
+				if err != nil {
+					// let the reflector restart the watch
+					return watch.Event{
+						Type:   watch.Error,
+						Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()},
+					}, true
+				}
+
+				return event, true
+			}), nil
+		},
+	}
+}
+
+func toObject(obj interface{}) (runtime.Object, error) {
+	res, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("transformation returned %T, not a runtime.Object", obj)
+	}
+	return res, nil
+}
@@ -0,0 +1,175 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// bloatedPod returns a pod with managedFields and the last applied
+// configuration, as returned by the API server
+func bloatedPod(name, rv string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			ResourceVersion: rv,
+			Annotations: map[string]string{
+				LastAppliedAnnotation: `{"apiVersion":"v1","kind":"Pod"}`,
+				"team":                "a",
+			},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply},
+			},
+		},
+	}
+}
+
+// expectTrimmed checks the cached pod has neither the managedFields
+// nor the last applied configuration, but still the other annotations
+func expectTrimmed(t *testing.T, store cache.Store, key, rv string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		obj, ok, err := store.GetByKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && obj.(*corev1.Pod).ResourceVersion == rv {
+			pod := obj.(*corev1.Pod)
+			if len(pod.ManagedFields) != 0 {
+				t.Fatalf("%s: managedFields not stripped: %v", key, pod.ManagedFields)
+			}
+			if _, ok := pod.Annotations[LastAppliedAnnotation]; ok {
+				t.Fatalf("%s: last applied configuration not dropped", key)
+			}
+			if pod.Annotations["team"] != "a" {
+				t.Fatalf("%s: other annotations dropped: %v", key, pod.Annotations)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s (resourceVersion %s)", key, rv)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListWatchTrimsTheInformerStore(t *testing.T) {
+	watcher := watch.NewFake()
+
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.PodList{
+				ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+				Items:    []corev1.Pod{*bloatedPod("a", "1")},
+			}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}
+
+	fn, err := Parse("managed-fields,last-applied")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	informer := cache.NewSharedIndexInformer(ListWatch(lw, fn), &corev1.Pod{}, 0, cache.Indexers{})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("failed to sync")
+	}
+
+	// after the List
+	expectTrimmed(t, informer.GetStore(), "default/a", "1")
+
+	// after the Watch events
+	watcher.Add(bloatedPod("b", "2"))
+	expectTrimmed(t, informer.GetStore(), "default/b", "2")
+
+	watcher.Modify(bloatedPod("a", "3"))
+	expectTrimmed(t, informer.GetStore(), "default/a", "3")
+}
+
+func TestListWatchReportsFailures(t *testing.T) {
+	watcher := watch.NewFake()
+
+	lw := ListWatch(&cache.ListWatch{
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watcher, nil
+		},
+	}, func(interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	go watcher.Add(bloatedPod("a", "1"))
+
+	event := <-w.ResultChan()
+	if event.Type != watch.Error {
+		t.Fatalf("got a %s event, expected an Error", event.Type)
+	}
+	if status, ok := event.Object.(*metav1.Status); !ok || status.Message != "boom" {
+		t.Fatalf("unexpected event object %#v", event.Object)
+	}
+}
+
+func TestDropSecretData(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"password": []byte("s3cr3t")}}
+
+	if _, err := DropSecretData()(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := secret.Data["password"]; !ok || v != nil {
+		t.Fatalf("expected the key with no value, got %v", secret.Data)
+	}
+}
+
+func TestTrimPodStatus(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{
+		Phase:             corev1.PodRunning,
+		PodIP:             "10.0.0.1",
+		ContainerStatuses: []corev1.ContainerStatus{{Name: "nginx"}},
+	}}
+
+	if _, err := TrimPodStatus()(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP != "10.0.0.1" {
+		t.Fatalf("the phase and the IPs must be kept, got %+v", pod.Status)
+	}
+	if len(pod.Status.ContainerStatuses) != 0 {
+		t.Fatalf("the container statuses must be dropped, got %+v", pod.Status.ContainerStatuses)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("managed-fields, last-applied,secret-data,pod-status"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse("managed-fields,everything"); err == nil {
+		t.Fatal("expected an error for an unknown transformation")
+	}
+}
@@ -0,0 +1,231 @@
+// Package watchlist gets the initial state of a collection and then
+// keeps watching it, using a single streaming watch when possible.
+//
+// The streaming list (sendInitialEvents=true) asks the API server to
+// send the current objects as ADDED events followed by a bookmark
+// annotated with `k8s.io/initial-events-end`; the watch then goes on
+// with the changes.  This avoids loading the whole collection in memory
+// at once (on both sides), as a List does.
+//
+// The servers that do not support streaming lists reject the request
+// (resourceVersionMatch is not allowed on a watch): in this case the
+// Watcher falls back to a List, whose items are sent as synthetic ADDED
+// events, followed by a Watch starting from the list resourceVersion.
+//
+// Either way, callers know the initial state is complete when the
+// channel returned by Synced is closed.
+package watchlist
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// InitialEventsEndAnnotation marks the bookmark sent by the
+// API server at the end of the initial events of a streaming list.
+const InitialEventsEndAnnotation = "k8s.io/initial-events-end"
+
+// the list options are encoded as plain "v1" parameters (any group)
+var paramsVersion = schema.GroupVersion{Version: "v1"}
+
+// Watcher is a watch.Interface that starts with the initial state
+// of the collection (ADDED events) and goes on with its changes.
+type Watcher struct {
+	result chan watch.Event
+	synced chan struct{}
+	cancel context.CancelFunc
+
+	streaming bool
+	// resourceVersion of the initial state, set before synced is closed
+	resourceVersion string
+}
+
+// Start begins watching the resource (i.e. "namespaces") in the specified
+// namespace ("" for all the namespaces or cluster scoped resources)
+// using the REST client of its API group; the label and field
+// selectors of the options are honored.
+func Start(ctx context.Context, client rest.Interface, namespace, resource string, opts metav1.ListOptions) (*Watcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := &Watcher{
+		result: make(chan watch.Event),
+		synced: make(chan struct{}),
+		cancel: cancel,
+	}
+
+	// first of all, try the streaming list
+	stream, err := watchStreaming(ctx, client, namespace, resource, opts)
+	if err == nil {
+		w.streaming = true
+		go w.forward(ctx, stream, nil)
+		return w, nil
+	}
+
+	if !errors.IsBadRequest(err) && !errors.IsInvalid(err) {
+		cancel()
+		return nil, err
+	}
+
+	// not supported: List + Watch
+	initial, rv, err := list(ctx, client, namespace, resource, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	opts.ResourceVersion = rv
+	opts.AllowWatchBookmarks = true
+	opts.Watch = true
+
+	stream, err = request(client, namespace, resource, opts).Watch(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w.resourceVersion = rv
+	go w.forward(ctx, stream, initial)
+
+	return w, nil
+}
+
+// ResultChan returns the events: first the initial state, then the changes.
+func (w *Watcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// Stop ends the watch and closes the result channel.
+func (w *Watcher) Stop() {
+	w.cancel()
+}
+
+// Synced returns a channel closed once all the events
+// of the initial state have been received from ResultChan.
+func (w *Watcher) Synced() <-chan struct{} {
+	return w.synced
+}
+
+// ResourceVersion returns the resourceVersion of the initial
+// state; it is meaningful only after Synced is closed.
+func (w *Watcher) ResourceVersion() string {
+	return w.resourceVersion
+}
+
+// Streaming returns true if the server supports streaming lists.
+func (w *Watcher) Streaming() bool {
+	return w.streaming
+}
+
+var _ watch.Interface = (*Watcher)(nil)
+
+// forward sends the initial events (if any) and then the stream
+// ones; in streaming mode the initial state ends with the annotated
+// bookmark, that is consumed here.
+func (w *Watcher) forward(ctx context.Context, stream watch.Interface, initial []watch.Event) {
+	defer close(w.result)
+	defer stream.Stop()
+
+	send := func(event watch.Event) bool {
+		select {
+		case w.result <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if !w.streaming {
+		for _, el := range initial {
+			if !send(el) {
+				return
+			}
+		}
+		close(w.synced)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-stream.ResultChan():
+			if !ok {
+				return
+			}
+
+			if w.streaming && event.Type == watch.Bookmark && isInitialEventsEnd(event) {
+				if obj, err := meta.Accessor(event.Object); err == nil {
+					w.resourceVersion = obj.GetResourceVersion()
+				}
+				close(w.synced)
+				continue
+			}
+
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+// watchStreaming starts a streaming list watch.
+func watchStreaming(ctx context.Context, client rest.Interface, namespace, resource string, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	opts.AllowWatchBookmarks = true
+	opts.ResourceVersion = ""
+	opts.ResourceVersionMatch = metav1.ResourceVersionMatchNotOlderThan
+
+	// not (yet) a field of metav1.ListOptions in this client-go version
+	return request(client, namespace, resource, opts).
+		Param("sendInitialEvents", "true").
+		Watch(ctx)
+}
+
+// list returns the items as ADDED events and the list resourceVersion.
+func list(ctx context.Context, client rest.Interface, namespace, resource string, opts metav1.ListOptions) ([]watch.Event, string, error) {
+	obj, err := request(client, namespace, resource, opts).Do(ctx).Get()
+	if err != nil {
+		return nil, "", err
+	}
+
+	lm, err := meta.ListAccessor(obj)
+	if err != nil {
+		return nil, "", err
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res := make([]watch.Event, 0, len(items))
+	for _, el := range items {
+		res = append(res, watch.Event{Type: watch.Added, Object: el})
+	}
+
+	return res, lm.GetResourceVersion(), nil
+}
+
+// request returns a GET request for the resource with the options.
+func request(client rest.Interface, namespace, resource string, opts metav1.ListOptions) *rest.Request {
+	return client.Get().
+		NamespaceIfScoped(namespace, len(namespace) > 0).
+		Resource(resource).
+		SpecificallyVersionedParams(&opts, scheme.ParameterCodec, paramsVersion)
+}
+
+// isInitialEventsEnd returns true for the bookmark ending the initial events.
+func isInitialEventsEnd(event watch.Event) bool {
+	obj, err := meta.Accessor(event.Object)
+	if err != nil {
+		return false
+	}
+	return obj.GetAnnotations()[InitialEventsEndAnnotation] == "true"
+}
@@ -0,0 +1,302 @@
+package watchlist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func namespace(name, rv string) *corev1.Namespace {
+	return &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: rv},
+	}
+}
+
+// initialEventsEnd is the bookmark ending the initial events
+func initialEventsEnd(rv string) *corev1.Namespace {
+	res := namespace("", rv)
+	res.Annotations = map[string]string{InitialEventsEndAnnotation: "true"}
+	return res
+}
+
+// fakeServer is an API server serving namespaces
+type fakeServer struct {
+	// the events of the streaming lists
+	streaming []watch.Event
+	// the error of the streaming lists, if not supported
+	rejection *apierrors.StatusError
+	// the fallback List
+	list *corev1.NamespaceList
+	// the events of the Watch following the List
+	events []watch.Event
+	// the error of every request
+	err *apierrors.StatusError
+
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.URL.Query())
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path != "/api/v1/namespaces" {
+		writeStatus(w, apierrors.NewNotFound(corev1.Resource("namespaces"), r.URL.Path))
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case f.err != nil:
+		writeStatus(w, f.err)
+
+	case query.Get("sendInitialEvents") == "true" && f.rejection != nil:
+		writeStatus(w, f.rejection)
+
+	case query.Get("sendInitialEvents") == "true":
+		writeEvents(w, f.streaming...)
+		<-r.Context().Done()
+
+	case query.Get("watch") == "true":
+		writeEvents(w, f.events...)
+		<-r.Context().Done()
+
+	default:
+		json.NewEncoder(w).Encode(f.list)
+	}
+}
+
+func (f *fakeServer) queries() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.requests...)
+}
+
+func writeStatus(w http.ResponseWriter, err *apierrors.StatusError) {
+	status := err.Status()
+	status.APIVersion, status.Kind = "v1", "Status"
+	w.WriteHeader(int(status.Code))
+	json.NewEncoder(w).Encode(status)
+}
+
+func writeEvents(w http.ResponseWriter, events ...watch.Event) {
+	enc := json.NewEncoder(w)
+	for _, el := range events {
+		raw, _ := json.Marshal(el.Object)
+		enc.Encode(metav1.WatchEvent{Type: string(el.Type), Object: runtime.RawExtension{Raw: raw}})
+	}
+	w.(http.Flusher).Flush()
+}
+
+// start begins watching the namespaces served by the fake server
+func start(t *testing.T, f *fakeServer, opts metav1.ListOptions) (*Watcher, error) {
+	t.Helper()
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, QPS: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	w, err := Start(ctx, cs.CoreV1().RESTClient(), "", "namespaces", opts)
+	if err == nil {
+		t.Cleanup(w.Stop)
+	}
+	return w, err
+}
+
+// next returns the next event of the watcher
+func next(t *testing.T, w *Watcher) watch.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-w.ResultChan():
+		if !ok {
+			t.Fatal("the watcher has been closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	return watch.Event{}
+}
+
+func expectEvent(t *testing.T, event watch.Event, et watch.EventType, name, rv string) {
+	t.Helper()
+
+	ns, ok := event.Object.(*corev1.Namespace)
+	if !ok {
+		t.Fatalf("got a %T, expected a namespace", event.Object)
+	}
+	if event.Type != et || ns.Name != name || ns.ResourceVersion != rv {
+		t.Fatalf("got %s %s@%s, expected %s %s@%s", event.Type, ns.Name, ns.ResourceVersion, et, name, rv)
+	}
+}
+
+func expectSynced(t *testing.T, w *Watcher, expected bool) {
+	t.Helper()
+
+	timeout := 5 * time.Second
+	if !expected {
+		timeout = 50 * time.Millisecond
+	}
+
+	select {
+	case <-w.Synced():
+		if !expected {
+			t.Fatal("synced before the end of the initial events")
+		}
+	case <-time.After(timeout):
+		if expected {
+			t.Fatal("not synced")
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	f := &fakeServer{streaming: []watch.Event{
+		{Type: watch.Added, Object: namespace("a", "5")},
+		{Type: watch.Added, Object: namespace("b", "6")},
+		{Type: watch.Bookmark, Object: initialEventsEnd("7")},
+		{Type: watch.Modified, Object: namespace("a", "8")},
+	}}
+
+	w, err := start(t, f, metav1.ListOptions{LabelSelector: "team=a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Streaming() {
+		t.Fatal("not streaming")
+	}
+
+	expectEvent(t, next(t, w), watch.Added, "a", "5")
+	// the forwarding of the next event is pending
+	expectSynced(t, w, false)
+	expectEvent(t, next(t, w), watch.Added, "b", "6")
+
+	expectSynced(t, w, true)
+	if got := w.ResourceVersion(); got != "7" {
+		t.Fatalf("got resourceVersion %q, expected the bookmark one", got)
+	}
+
+	// the bookmark is consumed
+	expectEvent(t, next(t, w), watch.Modified, "a", "8")
+
+	queries := f.queries()
+	if len(queries) != 1 {
+		t.Fatalf("got %d requests, expected a single watch", len(queries))
+	}
+	expected := map[string]string{
+		"watch":                "true",
+		"allowWatchBookmarks":  "true",
+		"resourceVersionMatch": "NotOlderThan",
+		"labelSelector":        "team=a",
+	}
+	for key, val := range expected {
+		if got := queries[0].Get(key); got != val {
+			t.Errorf("got %s=%q, expected %q", key, got, val)
+		}
+	}
+
+	// stopping closes the result channel
+	w.Stop()
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	// how the servers not knowing the streaming lists reject them
+	tests := map[string]*apierrors.StatusError{
+		"invalid":     apierrors.NewInvalid(metav1.SchemeGroupVersion.WithKind("ListOptions").GroupKind(), "", nil),
+		"bad request": apierrors.NewBadRequest("resourceVersionMatch is forbidden for watch"),
+	}
+
+	for name, rejection := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeServer{
+				list: &corev1.NamespaceList{
+					TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NamespaceList"},
+					ListMeta: metav1.ListMeta{ResourceVersion: "10"},
+					Items:    []corev1.Namespace{*namespace("a", "5"), *namespace("b", "6")},
+				},
+				events:    []watch.Event{{Type: watch.Modified, Object: namespace("a", "11")}},
+				rejection: rejection,
+			}
+
+			w, err := start(t, f, metav1.ListOptions{LabelSelector: "team=a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.Streaming() {
+				t.Fatal("streaming")
+			}
+
+			// the list items, as ADDED events
+			expectEvent(t, next(t, w), watch.Added, "a", "5")
+			expectSynced(t, w, false)
+			expectEvent(t, next(t, w), watch.Added, "b", "6")
+
+			expectSynced(t, w, true)
+			if got := w.ResourceVersion(); got != "10" {
+				t.Fatalf("got resourceVersion %q, expected the list one", got)
+			}
+
+			expectEvent(t, next(t, w), watch.Modified, "a", "11")
+
+			// streaming list, List, Watch
+			queries := f.queries()
+			if len(queries) != 3 {
+				t.Fatalf("got %d requests, expected 3", len(queries))
+			}
+			if queries[1].Get("watch") != "" || queries[1].Get("labelSelector") != "team=a" {
+				t.Fatalf("unexpected list %v", queries[1])
+			}
+			if queries[2].Get("watch") != "true" || queries[2].Get("resourceVersion") != "10" ||
+				queries[2].Get("labelSelector") != "team=a" {
+				t.Fatalf("unexpected watch %v", queries[2])
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := &fakeServer{err: apierrors.NewForbidden(corev1.Resource("namespaces"), "", nil)}
+
+	_, err := start(t, f, metav1.ListOptions{})
+	if !apierrors.IsForbidden(err) {
+		t.Fatalf("got %v, expected a forbidden error", err)
+	}
+
+	// no fallback
+	if got := len(f.queries()); got != 1 {
+		t.Fatalf("got %d requests, expected 1", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucasepe/using-client-go/pkg/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// go run main.go -namespace kube-system
+func main() {
+	defaultKubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	if len(defaultKubeconfig) == 0 {
+		defaultKubeconfig = clientcmd.RecommendedHomeFile
+	}
+
+	kubeconfig := flag.String(clientcmd.RecommendedConfigPathFlag,
+		defaultKubeconfig, "absolute path to the kubeconfig file")
+
+	namespace := flag.String("namespace", metav1.NamespaceDefault,
+		"list the pods of this namespace")
+
+	flag.Parse()
+
+	rc, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		panic(err)
+	}
+
+	// spans are kept in memory and printed at the end; in a real
+	// setup you would use an exporter sending them to a collector
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	// wrap the default RoundTripper with the tracing one
+	rc.WrapTransport = tracing.Wrap(tp)
+
+	cs, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		panic(err)
+	}
+
+	// the caller span: every API request will be a child of this one
+	ctx, span := tp.Tracer("main").Start(context.Background(), "describe-pods")
+
+	list, err := cs.CoreV1().Pods(*namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, el := range list.Items {
+		pod, err := cs.CoreV1().Pods(*namespace).Get(ctx, el.GetName(), metav1.GetOptions{})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s (phase: %s)\n", pod.GetName(), pod.Status.Phase)
+	}
+
+	span.End()
+
+	// print all the recorded spans
+	fmt.Printf("\n---- Recorded spans ----\n")
+	for _, el := range exporter.GetSpans() {
+		fmt.Printf("%s (trace: %s, parent: %s, duration: %s, status: %s)\n",
+			el.Name, el.SpanContext.TraceID(), el.Parent.SpanID(),
+			el.EndTime.Sub(el.StartTime), el.Status.Code)
+		for _, kv := range el.Attributes {
+			fmt.Printf("  %s: %s\n", kv.Key, kv.Value.Emit())
+		}
+	}
+}
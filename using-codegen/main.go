@@ -7,13 +7,19 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/PaesslerAG/gval"
 
+	"github.com/lucasepe/using-client-go/pkg/recorder"
 	expressionV1alpha1Api "github.com/lucasepe/using-client-go/using-codegen/pkg/apis/expression/v1alpha1"
 	expressionV1alpha1Clientset "github.com/lucasepe/using-client-go/using-codegen/pkg/generated/clientset/versioned"
+	expressionV1alpha1Scheme "github.com/lucasepe/using-client-go/using-codegen/pkg/generated/clientset/versioned/scheme"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -59,25 +65,51 @@ func main() {
 		panic(err)
 	}
 
-	res, err := cs.ExampleV1alpha1().Expressions(*namespace).
-		Get(context.TODO(), flag.Args()[0], metav1.GetOptions{})
+	// the Events are written using the kubernetes clientset
+	kcs, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		panic(err)
 	}
 
+	// records the Events about the evaluated expressions
+	// (the generated scheme knows about the Expression type)
+	rec := recorder.New(kcs, expressionV1alpha1Scheme.Scheme, "expression-evaluator")
+	defer rec.Flush(5 * time.Second)
+
+	if _, err := evaluate(context.TODO(), cs, rec, *namespace, flag.Args()[0]); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Expression evaluated! Type 'kubectl get exp %s' to check the result.\n", flag.Args()[0])
+}
+
+// evaluate stores the result of the expression in its status and
+// records an Event about the evaluation (successful or not)
+func evaluate(ctx context.Context, cs expressionV1alpha1Clientset.Interface, rec record.EventRecorder, namespace, name string) (*expressionV1alpha1Api.Expression, error) {
+	res, err := cs.ExampleV1alpha1().Expressions(namespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
 	val, err := evalExpression(res)
 	if err != nil {
-		panic(err)
+		rec.Eventf(res, corev1.EventTypeWarning, "EvaluationFailed",
+			"Expression '%s' cannot be evaluated: %v", res.Spec.Body, err)
+		return nil, err
 	}
 	res.Status.Result = strval(val)
 
-	_, err = cs.ExampleV1alpha1().Expressions(*namespace).
-		UpdateStatus(context.TODO(), res, metav1.UpdateOptions{})
+	res, err = cs.ExampleV1alpha1().Expressions(namespace).
+		UpdateStatus(ctx, res, metav1.UpdateOptions{})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	fmt.Printf("Expression evaluated! Type 'kubectl get exp %s' to check the result.\n", flag.Args()[0])
+	rec.Eventf(res, corev1.EventTypeNormal, "Evaluated",
+		"Expression '%s' evaluated to '%s'", res.Spec.Body, res.Status.Result)
+
+	return res, nil
 }
 
 func evalExpression(src *expressionV1alpha1Api.Expression) (string, error) {
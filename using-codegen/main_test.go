@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	expressionV1alpha1Api "github.com/lucasepe/using-client-go/using-codegen/pkg/apis/expression/v1alpha1"
+	"github.com/lucasepe/using-client-go/using-codegen/pkg/generated/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func expression(name, body, data string) *expressionV1alpha1Api.Expression {
+	return &expressionV1alpha1Api.Expression{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       expressionV1alpha1Api.ExpressionSpec{Body: body, Data: data},
+	}
+}
+
+func TestEvaluateRecordsEvaluated(t *testing.T) {
+	cs := fake.NewSimpleClientset(expression("sum", "a + b", `{"a": 1, "b": 2}`))
+	rec := record.NewFakeRecorder(10)
+
+	res, err := evaluate(context.TODO(), cs, rec, "default", "sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status.Result != "3" {
+		t.Fatalf("got result %q, expected %q", res.Status.Result, "3")
+	}
+
+	select {
+	case got := <-rec.Events:
+		if expected := "Normal Evaluated Expression 'a + b' evaluated to '3'"; got != expected {
+			t.Fatalf("got event %q, expected %q", got, expected)
+		}
+	default:
+		t.Fatal("no event recorded")
+	}
+}
+
+func TestEvaluateRecordsEvaluationFailed(t *testing.T) {
+	cs := fake.NewSimpleClientset(expression("broken", "a +", `{"a": 1}`))
+	rec := record.NewFakeRecorder(10)
+
+	if _, err := evaluate(context.TODO(), cs, rec, "default", "broken"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	select {
+	case got := <-rec.Events:
+		if expected := "Warning EvaluationFailed Expression 'a +' cannot be evaluated:"; !strings.HasPrefix(got, expected) {
+			t.Fatalf("got event %q, expected %q...", got, expected)
+		}
+	default:
+		t.Fatal("no event recorded")
+	}
+
+	// the status is left untouched
+	res, err := cs.ExampleV1alpha1().Expressions("default").Get(context.TODO(), "broken", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status.Result != "" {
+		t.Fatalf("unexpected result %q", res.Status.Result)
+	}
+}
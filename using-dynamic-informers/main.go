@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/handler"
+	"github.com/lucasepe/using-client-go/pkg/resource"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// go run main.go pizzas.bella.napoli.it deploy
+// go run main.go -l app=demo -crds bella.napoli.it
+func main() {
+	namespace := flag.String("n", metav1.NamespaceAll, "watch the resources in this namespace (default all)")
+	labelSelector := flag.String("l", "", "label selector to filter the resources")
+	fieldSelector := flag.String("field-selector", "", "field selector to filter the resources")
+	resyncIn := flag.Duration("resync", 0, "resync period of the informers")
+	crdGroups := flag.String("crds", "", "watch the custom resources of the CRDs in these groups (comma separated, * for all) as they are installed or removed")
+
+	flag.Usage = func() {
+		name := os.Args[0]
+		if strings.Contains(name, "go-build") {
+			name = "go run main.go"
+		}
+
+		w := flag.CommandLine.Output()
+		fmt.Fprintf(w, "Usage:  %s [resource or kind name (i.e. pods, deploy, pizzas.bella.napoli.it)]...\n\n", name)
+
+		fmt.Fprintf(w, "Flags:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) == 0 && len(*crdGroups) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+
+	cfg, err := configLoader.ClientConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// a RESTMapper backed by the discovery client (cached in memory)
+	// that knows about the short names (i.e. deploy, exp) as well
+	mapper := resource.NewMapper(dc)
+
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// the selectors are applied to every List and Watch
+	tweak := func(opts *metav1.ListOptions) {
+		opts.LabelSelector = *labelSelector
+		opts.FieldSelector = *fieldSelector
+	}
+
+	// cluster scoped resources cannot be listed in a namespace:
+	// they get their own factory
+	namespacedFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dyn, *resyncIn, *namespace, tweak)
+	clusterFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dyn, *resyncIn, metav1.NamespaceAll, tweak)
+
+	var synced []cache.InformerSynced
+	// the same resource could be given twice (i.e. deploy and deployments.apps)
+	watched := map[schema.GroupResource]bool{}
+	for _, el := range flag.Args() {
+		mapping, err := resource.Resolve(mapper, el)
+		if err != nil {
+			panic(err)
+		}
+
+		if watched[mapping.Resource.GroupResource()] {
+			continue
+		}
+		watched[mapping.Resource.GroupResource()] = true
+
+		factory := clusterFactory
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			factory = namespacedFactory
+		}
+
+		// the factory creates (once) the informer for the GVR
+		informer := factory.ForResource(mapping.Resource).Informer()
+		informer.AddEventHandler(printer(mapping.Resource.GroupResource().String()))
+		synced = append(synced, informer.HasSynced)
+
+		fmt.Printf("---- Watching %s (%s) ----\n", mapping.Resource.GroupResource(), mapping.GroupVersionKind)
+	}
+
+	// canceled on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
+
+	// starts the informers created so far
+	namespacedFactory.Start(ctx.Done())
+	clusterFactory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		panic("failed to sync")
+	}
+
+	if len(*crdGroups) > 0 {
+		crds := &crdWatcher{
+			dyn:       dyn,
+			namespace: *namespace,
+			resync:    *resyncIn,
+			tweak:     tweak,
+			groups:    strings.Split(*crdGroups, ","),
+			static:    watched,
+			running:   map[schema.GroupResource]*crdInformer{},
+		}
+		crds.Run(ctx)
+	}
+
+	// blocks until a signal is received: then the informers stop
+	<-ctx.Done()
+}
+
+// crdWatcher starts an informer for the custom resources of each
+// established CRD, and stops it when the CRD is removed
+type crdWatcher struct {
+	dyn       dynamic.Interface
+	namespace string
+	resync    time.Duration
+	tweak     dynamicinformer.TweakListOptionsFunc
+	groups    []string
+	// the resources already watched (given on the command line)
+	static map[schema.GroupResource]bool
+
+	// the context of the CRDs informer, parent of all the others
+	ctx context.Context
+	// the running informers; the CRD handler
+	// calls are sequential, no need for a lock
+	running map[schema.GroupResource]*crdInformer
+}
+
+// crdInformer is a running informer of custom resources
+type crdInformer struct {
+	// the storage version being watched
+	version string
+	cancel  context.CancelFunc
+}
+
+// the CRDs themselves are watched using a dynamic informer too
+var crdsGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// Run starts watching the CRDs, until the context is done
+// (the informers of the custom resources stop too)
+func (w *crdWatcher) Run(ctx context.Context) {
+	w.ctx = ctx
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(w.dyn, 0)
+
+	informer := factory.ForResource(crdsGVR).Informer()
+	informer.AddEventHandler(handler.Funcs[*unstructured.Unstructured]{
+		AddFunc: w.sync,
+		UpdateFunc: func(_, crd *unstructured.Unstructured) {
+			w.sync(crd)
+		},
+		DeleteFunc: func(crd *unstructured.Unstructured) {
+			if gvr, _, ok := customResource(crd); ok {
+				w.stop(gvr.GroupResource())
+			}
+		},
+	})
+
+	factory.Start(ctx.Done())
+}
+
+// sync starts the informer of an established CRD (in the selected
+// groups) or stops it if the CRD is not served anymore; when the
+// storage version changes, the informer is restarted with it
+func (w *crdWatcher) sync(crd *unstructured.Unstructured) {
+	gvr, namespaced, ok := customResource(crd)
+	if !ok || !w.selected(gvr.Group) || w.static[gvr.GroupResource()] {
+		return
+	}
+
+	if !isEstablished(crd) || crd.GetDeletionTimestamp() != nil {
+		w.stop(gvr.GroupResource())
+		return
+	}
+
+	if el, ok := w.running[gvr.GroupResource()]; ok {
+		if el.version == gvr.Version {
+			return
+		}
+		w.stop(gvr.GroupResource())
+	}
+
+	namespace := metav1.NamespaceAll
+	if namespaced {
+		namespace = w.namespace
+	}
+
+	informer := dynamicinformer.NewFilteredDynamicInformer(w.dyn, gvr, namespace, w.resync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, w.tweak)
+	informer.Informer().AddEventHandler(printer(gvr.GroupResource().String()))
+
+	// stopped with the CRD or with the whole program
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.running[gvr.GroupResource()] = &crdInformer{version: gvr.Version, cancel: cancel}
+
+	go informer.Informer().Run(ctx.Done())
+
+	fmt.Printf("---- CRD installed, watching %s ----\n", gvr)
+}
+
+// stop stops the informer of the resource, if running
+func (w *crdWatcher) stop(gr schema.GroupResource) {
+	el, ok := w.running[gr]
+	if !ok {
+		return
+	}
+
+	el.cancel()
+	delete(w.running, gr)
+
+	fmt.Printf("---- CRD removed or changed, stopped watching %s (version %s) ----\n", gr, el.version)
+}
+
+// selected returns true if the group is one of the selected ones
+func (w *crdWatcher) selected(group string) bool {
+	for _, el := range w.groups {
+		if el == "*" || el == group {
+			return true
+		}
+	}
+	return false
+}
+
+// customResource returns the GVR of the storage version of
+// the CRD (the first served one if none is) and its scope
+func customResource(crd *unstructured.Unstructured) (schema.GroupVersionResource, bool, bool) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	var version string
+	for _, el := range versions {
+		v, ok := el.(map[string]interface{})
+		if !ok || v["served"] != true {
+			continue
+		}
+		if len(version) == 0 || v["storage"] == true {
+			version, _ = v["name"].(string)
+		}
+	}
+
+	if len(group) == 0 || len(plural) == 0 || len(version) == 0 {
+		return schema.GroupVersionResource{}, false, false
+	}
+
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: plural}
+	return gvr, scope == "Namespaced", true
+}
+
+// isEstablished returns true if the CRD has the Established condition
+func isEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, el := range conditions {
+		c, ok := el.(map[string]interface{})
+		if ok && c["type"] == "Established" && c["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// printer returns an event handler printing the events of a resource
+func printer(gr string) cache.ResourceEventHandler {
+	return handler.Funcs[*unstructured.Unstructured]{
+		AddFunc: func(obj *unstructured.Unstructured) {
+			fmt.Printf("+ %s %s (resourceVersion: %s)\n", gr, resource.DisplayName(obj), obj.GetResourceVersion())
+		},
+		UpdateFunc: func(old, obj *unstructured.Unstructured) {
+			// resyncs deliver the same object again
+			if old.GetResourceVersion() == obj.GetResourceVersion() {
+				return
+			}
+			fmt.Printf("~ %s %s (resourceVersion: %s)\n", gr, resource.DisplayName(obj), obj.GetResourceVersion())
+		},
+		DeleteFunc: func(obj *unstructured.Unstructured) {
+			fmt.Printf("- %s %s\n", gr, resource.DisplayName(obj))
+		},
+	}
+}
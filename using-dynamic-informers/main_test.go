@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var pizzas = schema.GroupResource{Group: "bella.napoli.it", Resource: "pizzas"}
+
+// newCRD returns the established CRD of the pizzas,
+// with the specified storage version
+func newCRD(storage string) *unstructured.Unstructured {
+	versions := []interface{}{}
+	for _, el := range []string{"v1", "v2"} {
+		versions = append(versions, map[string]interface{}{
+			"name":    el,
+			"served":  true,
+			"storage": el == storage,
+		})
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "pizzas.bella.napoli.it"},
+		"spec": map[string]interface{}{
+			"group":    pizzas.Group,
+			"scope":    "Namespaced",
+			"names":    map[string]interface{}{"plural": pizzas.Resource},
+			"versions": versions,
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Established", "status": "True"},
+			},
+		},
+	}}
+}
+
+func newCRDWatcher(t *testing.T, static ...schema.GroupResource) *crdWatcher {
+	t.Helper()
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			pizzas.WithVersion("v1"): "PizzaList",
+			pizzas.WithVersion("v2"): "PizzaList",
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	w := &crdWatcher{
+		dyn:     dyn,
+		groups:  []string{"*"},
+		static:  map[schema.GroupResource]bool{},
+		ctx:     ctx,
+		running: map[schema.GroupResource]*crdInformer{},
+	}
+	for _, el := range static {
+		w.static[el] = true
+	}
+
+	return w
+}
+
+func TestSyncRestartsOnStorageVersionChange(t *testing.T) {
+	w := newCRDWatcher(t)
+
+	w.sync(newCRD("v1"))
+	first, ok := w.running[pizzas]
+	if !ok || first.version != "v1" {
+		t.Fatalf("got %+v, expected an informer of v1", first)
+	}
+
+	// i.e. a resync: nothing changed
+	w.sync(newCRD("v1"))
+	if w.running[pizzas] != first {
+		t.Fatal("the informer has been restarted")
+	}
+
+	w.sync(newCRD("v2"))
+	if el := w.running[pizzas]; el == first || el.version != "v2" {
+		t.Fatalf("got %+v, expected a new informer of v2", el)
+	}
+}
+
+func TestSyncStopsTheRemovedCRDs(t *testing.T) {
+	w := newCRDWatcher(t)
+
+	w.sync(newCRD("v1"))
+	if _, ok := w.running[pizzas]; !ok {
+		t.Fatal("the informer has not been started")
+	}
+
+	// being deleted
+	crd := newCRD("v1")
+	now := metav1.Now()
+	crd.SetDeletionTimestamp(&now)
+	w.sync(crd)
+
+	if _, ok := w.running[pizzas]; ok {
+		t.Fatal("the informer has not been stopped")
+	}
+}
+
+func TestSyncSkipsTheWatchedResources(t *testing.T) {
+	// given on the command line too
+	w := newCRDWatcher(t, pizzas)
+
+	w.sync(newCRD("v1"))
+	if len(w.running) > 0 {
+		t.Fatal("the resource is watched twice")
+	}
+
+	// not in the selected groups
+	w = newCRDWatcher(t)
+	w.groups = []string{"example.com"}
+
+	w.sync(newCRD("v1"))
+	if len(w.running) > 0 {
+		t.Fatal("a resource of another group is watched")
+	}
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"time"
 
+	"github.com/lucasepe/using-client-go/pkg/recorder"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 func main() {
@@ -31,21 +38,44 @@ func main() {
 		panic(err)
 	}
 
-	// identify out custom resource
-	gvr := schema.GroupVersionResource{
-		Group:    "bella.napoli.it",
-		Version:  "v1alpha1",
-		Resource: "pizzas",
+	// the Events are written using a typed client
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// records the Events about the pizzas we update
+	rec := recorder.New(cs, scheme.Scheme, "pizza-pricing")
+	defer rec.Flush(5 * time.Second)
+
+	// change the 'margherita' price (if there is one)
+	if _, err := updatePrice(context.TODO(), dc, rec, namespace, "margherita", margheritaCost); err != nil {
+		panic(err)
 	}
-	// retrieve the resource of kind Pizza named 'margherita'
-	res, err := dc.Resource(gvr).
+}
+
+// margheritaCost is the new price of the 'margherita'
+const margheritaCost = 6.50
+
+// pizzasGVR identifies our custom resource
+var pizzasGVR = schema.GroupVersionResource{
+	Group:    "bella.napoli.it",
+	Version:  "v1alpha1",
+	Resource: "pizzas",
+}
+
+// updatePrice sets the cost in the status of the pizza and records
+// an Event about it; it returns nil if the pizza does not exist
+func updatePrice(ctx context.Context, dc dynamic.Interface, rec record.EventRecorder, namespace, name string, cost float64) (*unstructured.Unstructured, error) {
+	// retrieve the resource of kind Pizza with the specified name
+	res, err := dc.Resource(pizzasGVR).
 		Namespace(namespace).
-		Get(context.TODO(), "margherita", metav1.GetOptions{})
+		Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return
+			return nil, nil
 		}
-		panic(err)
+		return nil, err
 	}
 
 	// grab the status if exists
@@ -55,13 +85,18 @@ func main() {
 		status = make(map[string]interface{})
 	}
 
-	// change the 'margherita' price
-	status.(map[string]interface{})["cost"] = 6.50
+	// change the price
+	status.(map[string]interface{})["cost"] = cost
 	res.Object["status"] = status
 
-	// update the 'margherita' custom resource with the new price
-	_, err = dc.Resource(gvr).Namespace(namespace).Update(context.TODO(), res, metav1.UpdateOptions{})
+	// update the custom resource with the new price
+	res, err = dc.Resource(pizzasGVR).Namespace(namespace).Update(ctx, res, metav1.UpdateOptions{})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+
+	rec.Eventf(res, corev1.EventTypeNormal, "PriceUpdated",
+		"Pizza '%s' now costs %.2f", res.GetName(), cost)
+
+	return res, nil
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestUpdatePriceRecordsEvent(t *testing.T) {
+	pizza := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "bella.napoli.it/v1alpha1",
+		"kind":       "Pizza",
+		"metadata": map[string]interface{}{
+			"namespace": "default",
+			"name":      "margherita",
+		},
+	}}
+
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pizzasGVR: "PizzaList"}, pizza)
+	rec := record.NewFakeRecorder(10)
+
+	res, err := updatePrice(context.TODO(), dc, rec, "default", "margherita", margheritaCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cost, found, err := unstructured.NestedFloat64(res.Object, "status", "cost")
+	if err != nil || !found || cost != margheritaCost {
+		t.Fatalf("got cost %v (found: %t, err: %v), expected %v", cost, found, err, margheritaCost)
+	}
+
+	select {
+	case got := <-rec.Events:
+		if expected := "Normal PriceUpdated Pizza 'margherita' now costs 6.50"; got != expected {
+			t.Fatalf("got event %q, expected %q", got, expected)
+		}
+	default:
+		t.Fatal("no event recorded")
+	}
+}
+
+func TestUpdatePriceMissingPizza(t *testing.T) {
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pizzasGVR: "PizzaList"})
+	rec := record.NewFakeRecorder(10)
+
+	res, err := updatePrice(context.TODO(), dc, rec, "default", "margherita", margheritaCost)
+	if err != nil || res != nil {
+		t.Fatalf("got %v, %v, expected nothing", res, err)
+	}
+
+	select {
+	case got := <-rec.Events:
+		t.Fatalf("unexpected event %q", got)
+	default:
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/scanner"
+	"unicode"
+
+	expressionV1alpha1Api "github.com/lucasepe/using-client-go/using-codegen/pkg/apis/expression/v1alpha1"
+)
+
+// expressionsByVariable indexes the Expressions
+// by the names of the variables used in their body
+const expressionsByVariable = "expressions-by-variable"
+
+// keywords are the identifiers of the expression language
+// (gval) that are not variables
+var keywords = map[string]bool{"true": true, "false": true, "in": true}
+
+// expressionVariables is the index function returning the variables used
+// in the body of the Expression: for `price * (1 + vat.rate)` they are
+// `price` and `vat`, no matter what the data provides
+func expressionVariables(obj interface{}) ([]string, error) {
+	exp, ok := obj.(*expressionV1alpha1Api.Expression)
+	if !ok {
+		return nil, fmt.Errorf("expected an expression, got %T", obj)
+	}
+
+	return variables(exp.Spec.Body), nil
+}
+
+// variables returns the (sorted) variables used in the expression,
+// scanning it like gval does: an identifier is a variable unless it
+// is a keyword, a function name (followed by `(`) or a field name
+// (preceded by `.`); a broken expression gives what was found so far
+func variables(body string) []string {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(body))
+	s.Mode = scanner.GoTokens
+	s.IsIdentRune = func(r rune, pos int) bool {
+		return r == '_' || unicode.IsLetter(r) || (pos > 0 && unicode.IsDigit(r))
+	}
+	// the expression is not validated here
+	s.Error = func(*scanner.Scanner, string) {}
+
+	found := map[string]bool{}
+
+	prev := rune(scanner.EOF)
+	ident := ""
+	for tok := s.Scan(); ; tok = s.Scan() {
+		// the previous identifier was not a function name
+		if len(ident) > 0 && tok != '(' {
+			found[ident] = true
+		}
+		ident = ""
+
+		if tok == scanner.EOF {
+			break
+		}
+		if tok == scanner.Ident && prev != '.' && !keywords[s.TokenText()] {
+			ident = s.TokenText()
+		}
+		prev = tok
+	}
+
+	res := make([]string, 0, len(found))
+	for el := range found {
+		res = append(res, el)
+	}
+	sort.Strings(res)
+
+	return res
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/indexers"
+	expressionV1alpha1Api "github.com/lucasepe/using-client-go/using-codegen/pkg/apis/expression/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestVariables(t *testing.T) {
+	tests := map[string][]string{
+		"x + y * 2":                       {"x", "y"},
+		"price * (1 + vat.rate)":          {"price", "vat"},
+		`items[idx] == "x" && ok != true`: {"idx", "items", "ok"},
+		`date(when) > date("2022-01-01")`: {"when"},
+		"a in [b, 1.5, false]":            {"a", "b"},
+		"x + x_2 - x":                     {"x", "x_2"},
+		`"just a string"`:                 {},
+		"":                                {},
+		"x + (y":                          {"x", "y"}, // broken: what was found so far
+	}
+
+	for body, expected := range tests {
+		if got := variables(body); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: got %v, expected %v", body, got, expected)
+		}
+	}
+}
+
+func TestExpressionsByVariable(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		expressionsByVariable: expressionVariables,
+	})
+
+	expressions := map[string]expressionV1alpha1Api.ExpressionSpec{
+		// the data does not matter: only what the body uses
+		"sum":   {Body: "x + y", Data: `{"x": 1, "y": 2, "z": 3}`},
+		"twice": {Body: "x * 2", Data: `{}`},
+	}
+	for name, spec := range expressions {
+		err := indexer.Add(&expressionV1alpha1Api.Expression{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       spec,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string][]string{
+		"x": {"default/sum", "default/twice"},
+		"y": {"default/sum"},
+		"z": {},
+	}
+
+	for variable, expected := range tests {
+		keys, err := indexer.IndexKeys(expressionsByVariable, variable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) == 0 {
+			keys = []string{}
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("%s: got %v, expected %v", variable, keys, expected)
+		}
+	}
+
+	// only expressions can be indexed
+	if _, err := expressionVariables(&corev1.Pod{}); err == nil {
+		t.Fatal("a pod has been indexed")
+	}
+
+	// and read back with the right type
+	items, err := indexers.ByIndex[*expressionV1alpha1Api.Expression](indexer, expressionsByVariable, "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Name != "sum" {
+		t.Fatalf("unexpected expressions %v", items)
+	}
+}
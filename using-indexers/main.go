@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/indexers"
+	expressionV1alpha1Api "github.com/lucasepe/using-client-go/using-codegen/pkg/apis/expression/v1alpha1"
+	expressionV1alpha1Clientset "github.com/lucasepe/using-client-go/using-codegen/pkg/generated/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// go run main.go -secret default/my-secret
+// go run main.go -node kind-control-plane
+// go run main.go -variable x
+func main() {
+	defaultKubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	if len(defaultKubeconfig) == 0 {
+		defaultKubeconfig = clientcmd.RecommendedHomeFile
+	}
+
+	kubeconfig := flag.String(clientcmd.RecommendedConfigPathFlag,
+		defaultKubeconfig, "absolute path to the kubeconfig file")
+
+	secret := flag.String("secret", "", "show the pods using this secret (namespace/name)")
+	node := flag.String("node", "", "show the pods running on this node")
+	ownerUID := flag.String("owner-uid", "", "show the pods owned by the object with this UID")
+	variable := flag.String("variable", "", "show the expressions using this variable")
+
+	flag.Parse()
+
+	rc, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	clientSet, err := kubernetes.NewForConfig(rc)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	informerFactory := informers.NewSharedInformerFactory(clientSet, 0)
+
+	podsInformer := informerFactory.Core().V1().Pods().Informer()
+
+	// the indexers must be added before starting the informer
+	err = podsInformer.AddIndexers(cache.Indexers{
+		indexers.PodsByNode:   indexers.PodNodeName,
+		indexers.PodsBySecret: indexers.PodSecrets,
+		indexers.ByOwnerUID:   indexers.OwnerUIDs,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	informerFactory.Start(stopCh)
+
+	// wait for the initial synchronization of the local cache
+	if !cache.WaitForCacheSync(stopCh, podsInformer.HasSynced) {
+		panic("failed to sync")
+	}
+
+	// from now on, no more API calls: everything comes from the cache
+	pods := podsInformer.GetIndexer()
+
+	if len(*secret) > 0 {
+		printPods(fmt.Sprintf("pods using secret %s", *secret),
+			pods, indexers.PodsBySecret, *secret)
+	}
+
+	if len(*node) > 0 {
+		printPods(fmt.Sprintf("pods on node %s", *node),
+			pods, indexers.PodsByNode, *node)
+	}
+
+	if len(*ownerUID) > 0 {
+		printPods(fmt.Sprintf("pods owned by %s", *ownerUID),
+			pods, indexers.ByOwnerUID, *ownerUID)
+	}
+
+	if len(*variable) > 0 {
+		printExpressions(rc, stopCh, *variable)
+	}
+}
+
+// printPods prints the pods having the specified index value
+func printPods(title string, indexer cache.Indexer, indexName, value string) {
+	items, err := indexers.ByIndex[*corev1.Pod](indexer, indexName, value)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("---- %s: %d ----\n", title, len(items))
+	for _, el := range items {
+		fmt.Printf("%s/%s (node: %s, phase: %s)\n",
+			el.Namespace, el.Name, el.Spec.NodeName, el.Status.Phase)
+	}
+}
+
+// printExpressions prints the expressions using the variable; there is
+// no generated informer for the Expressions: let's make one by hand
+func printExpressions(rc *rest.Config, stopCh <-chan struct{}, variable string) {
+	cs, err := expressionV1alpha1Clientset.NewForConfig(rc)
+	if err != nil {
+		panic(err)
+	}
+
+	listWatcher := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return cs.ExampleV1alpha1().Expressions(metav1.NamespaceAll).List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return cs.ExampleV1alpha1().Expressions(metav1.NamespaceAll).Watch(context.Background(), options)
+		},
+	}
+
+	informer := cache.NewSharedIndexInformer(listWatcher, &expressionV1alpha1Api.Expression{},
+		time.Duration(0), cache.Indexers{
+			cache.NamespaceIndex:  cache.MetaNamespaceIndexFunc,
+			expressionsByVariable: expressionVariables,
+		})
+
+	go informer.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		panic("failed to sync")
+	}
+
+	items, err := indexers.ByIndex[*expressionV1alpha1Api.Expression](informer.GetIndexer(),
+		expressionsByVariable, variable)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("---- expressions using variable %s: %d ----\n", variable, len(items))
+	for _, el := range items {
+		fmt.Printf("%s/%s: %s = %s\n", el.Namespace, el.Name, el.Spec.Body, el.Status.Result)
+	}
+}
@@ -4,11 +4,23 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/lucasepe/using-client-go/pkg/admin"
+	"github.com/lucasepe/using-client-go/pkg/handler"
+	"github.com/lucasepe/using-client-go/pkg/secretaudit"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	"github.com/lucasepe/using-client-go/pkg/transform"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -22,6 +34,17 @@ func main() {
 	kubeconfig := flag.String(clientcmd.RecommendedConfigPathFlag,
 		defaultKubeconfig, "absolute path to the kubeconfig file")
 
+	auditLog := flag.String("audit-log", "secrets-audit.jsonl", "file where the changes to the secrets are recorded")
+	auditMaxBytes := flag.Int64("audit-max-bytes", 10<<20, "size beyond which the audit log is rotated")
+	auditBackups := flag.Int("audit-backups", 5, "number of rotated audit logs to keep")
+	auditKeyFile := flag.String("audit-key-file", "", "file holding the HMAC key fingerprinting the secret values (i.e. head -c 32 /dev/urandom > audit.key): keep it secret")
+
+	transforms := flag.String("transform", "last-applied", "trim the cached secrets: last-applied (managed-fields and secret-data are rejected: the audit needs who changed the secrets and their data)")
+
+	adminAddr := flag.String("admin-addr", "", "serve /healthz, /readyz, /metrics and /debug/pprof on this address (i.e. :8080)")
+
+	metadataOnly := flag.Bool("metadata-only", false, "cache only the secrets metadata (no audit: the data is not there)")
+
 	flag.Parse()
 
 	rc, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
@@ -29,47 +52,149 @@ func main() {
 		panic(err.Error())
 	}
 
+	if *metadataOnly {
+		watchMetadata(rc)
+		return
+	}
+
+	// the audit can tell who changed a secret, and what, only
+	// if the managedFields and the data are cached
+	for _, el := range strings.Split(*transforms, ",") {
+		switch name := strings.TrimSpace(el); name {
+		case "managed-fields", "secret-data":
+			panic(fmt.Sprintf("the %s transformation blinds the audit", name))
+		}
+	}
+
+	// the values are fingerprinted with a secret key: a plain hash of
+	// a password could be reversed by brute force reading the log
+	if len(*auditKeyFile) == 0 {
+		panic("the -audit-key-file flag is required")
+	}
+	auditKey, err := os.ReadFile(*auditKeyFile)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	// the audit trail of the secrets changes (JSON lines)
+	log, err := secretaudit.NewLog(*auditLog, *auditMaxBytes, *auditBackups)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer log.Close()
+
 	// create a client set from config
 	clientSet, err := kubernetes.NewForConfig(rc)
 	if err != nil {
 		panic(err.Error())
 	}
 
+	// the secrets are trimmed before being cached
+	trim, err := transform.Parse(*transforms)
+	if err != nil {
+		panic(err.Error())
+	}
+
 	// create a new instance of sharedInformerFactory for all namespaces
 	informerFactory := informers.NewSharedInformerFactory(clientSet, time.Minute*1)
 
+	// replace the default secrets informer of the factory with one
+	// using a transforming ListerWatcher (it must be done before
+	// asking the factory for the secrets informer)
+	informerFactory.InformerFor(&corev1.Secret{},
+		func(cs kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+			lw := cache.NewListWatchFromClient(cs.CoreV1().RESTClient(),
+				"secrets", metav1.NamespaceAll, fields.Everything())
+
+			return cache.NewSharedIndexInformer(transform.ListWatch(lw, trim), &corev1.Secret{},
+				resync, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		})
+
 	// using this factory create an informer for `secret` resources
 	secretsInformer := informerFactory.Core().V1().Secrets()
 
-	// adds an event handler to the shared informer
-	secretsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			item := obj.(*corev1.Secret)
+	// the auditor records only the real changes (not the resyncs)
+	auditor, err := secretaudit.NewAuditor(log, auditKey)
+	if err != nil {
+		panic(err.Error())
+	}
+	auditor.OnRecord = func(rec secretaudit.Record) {
+		fmt.Printf("secret %s (ns=%s): %s (resourceVersion: %s, keys: %d, by: %v)\n",
+			rec.Action, rec.Namespace, rec.Name, rec.ResourceVersion, len(rec.Keys), rec.ChangedBy)
+	}
+
+	// adds the auditor as event handler to the shared informer
+	secretsInformer.Informer().AddEventHandler(auditor)
+
+	// canceled on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
+
+	// starts the shared informers that have been created by the factory
+	informerFactory.Start(ctx.Done())
+
+	// ready once the cache is synced
+	if len(*adminAddr) > 0 {
+		srv := admin.New(*adminAddr, prometheus.DefaultGatherer)
+		srv.AddReadyCheck("informers", admin.Synced(secretsInformer.Informer().HasSynced))
+
+		go func() {
+			if err := srv.Run(ctx); err != nil {
+				panic(err.Error())
+			}
+		}()
+	}
+
+	// wait for the initial synchronization of the local cache
+	if !cache.WaitForCacheSync(ctx.Done(), secretsInformer.Informer().HasSynced) {
+		panic("failed to sync")
+	}
+
+	// blocks until a signal is received: then the informers stop
+	// and the audit log is closed (writing what has been recorded)
+	<-ctx.Done()
+}
+
+// watchMetadata watches the secrets caching only their metadata
+// (as PartialObjectMetadata): the payloads are never kept in memory
+func watchMetadata(rc *rest.Config) {
+	// the metadata client asks the server for the metadata only
+	mc, err := metadata.NewForConfig(rc)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	informerFactory := metadatainformer.NewSharedInformerFactory(mc, time.Minute*1)
+
+	// there are no typed informers here: the resource is a GVR
+	secretsInformer := informerFactory.ForResource(corev1.SchemeGroupVersion.WithResource("secrets"))
+
+	secretsInformer.Informer().AddEventHandler(handler.Funcs[*metav1.PartialObjectMetadata]{
+		AddFunc: func(item *metav1.PartialObjectMetadata) {
 			fmt.Printf("secret added (ns=%s): %s\n", item.GetNamespace(), item.GetName())
 		},
-
-		UpdateFunc: func(old, new interface{}) {
-			item := old.(*corev1.Secret)
-			fmt.Printf("secret updated (ns=%s): %s\n", item.GetNamespace(), item.GetName())
+		UpdateFunc: func(old, item *metav1.PartialObjectMetadata) {
+			// resyncs deliver the same object again
+			if old.GetResourceVersion() == item.GetResourceVersion() {
+				return
+			}
+			fmt.Printf("secret updated (ns=%s): %s (resourceVersion: %s)\n",
+				item.GetNamespace(), item.GetName(), item.GetResourceVersion())
 		},
-
-		DeleteFunc: func(obj interface{}) {
-			item := obj.(*corev1.Secret)
+		DeleteFunc: func(item *metav1.PartialObjectMetadata) {
 			fmt.Printf("secret deleted (ns=%s): %s\n", item.GetNamespace(), item.GetName())
 		},
 	})
 
-	stopCh := make(chan struct{})
-	defer close(stopCh)
+	ctx, cancel := signals.Context()
+	defer cancel()
 
-	// starts the shared informers that have been created by the factory
-	informerFactory.Start(stopCh)
+	informerFactory.Start(ctx.Done())
 
-	// wait for the initial synchronization of the local cache
-	if !cache.WaitForCacheSync(stopCh, secretsInformer.Informer().HasSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), secretsInformer.Informer().HasSynced) {
 		panic("failed to sync")
 	}
 
-	// causes the goroutine to block (hit CTRL+C to exit)
-	select {}
+	// blocks until SIGINT (CTRL+C) or SIGTERM
+	<-ctx.Done()
 }
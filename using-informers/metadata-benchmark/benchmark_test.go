@@ -0,0 +1,161 @@
+package benchmark
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	count   = flag.Int("secrets", 10000, "number of synthetic secrets")
+	payload = flag.Int("payload", 4096, "size in bytes of the data of each secret")
+)
+
+func BenchmarkSecretsInformer(b *testing.B) {
+	b.Run("full", func(b *testing.B) {
+		measure(b, func() []k8sruntime.Object {
+			return fullSecrets(*count, *payload)
+		}, startFull)
+	})
+
+	b.Run("metadata", func(b *testing.B) {
+		measure(b, func() []k8sruntime.Object {
+			return metadataSecrets(*count)
+		}, startMetadata)
+	})
+}
+
+// setup creates a fake client serving the objects and returns
+// the function starting an informer (returned once synced)
+type setup func(b *testing.B, objects []k8sruntime.Object) func(stopCh <-chan struct{}) cache.SharedIndexInformer
+
+// measure times the informer sync and reports the heap retained by the
+// synced informer cache: the objects served by the fake client are
+// already in the baseline
+func measure(b *testing.B, objects func() []k8sruntime.Object, serve setup) {
+	objs := objects()
+
+	var heap, cached int64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		stopCh := make(chan struct{})
+		start := serve(b, objs)
+		before := heapInUse()
+		b.StartTimer()
+
+		informer := start(stopCh)
+
+		b.StopTimer()
+		heap += heapInUse() - before
+		cached += int64(len(informer.GetStore().ListKeys()))
+
+		// keep everything alive until measured
+		runtime.KeepAlive(informer)
+		close(stopCh)
+	}
+	runtime.KeepAlive(objs)
+
+	if cached == 0 {
+		b.Fatal("no objects cached")
+	}
+
+	b.ReportMetric(float64(cached)/float64(b.N), "objects")
+	b.ReportMetric(float64(heap)/float64(cached), "heap-B/object")
+}
+
+// startFull serves the objects with the fake clientset
+// and starts a typed Secrets informer
+func startFull(b *testing.B, objects []k8sruntime.Object) func(stopCh <-chan struct{}) cache.SharedIndexInformer {
+	cs := fake.NewSimpleClientset(objects...)
+
+	return func(stopCh <-chan struct{}) cache.SharedIndexInformer {
+		factory := informers.NewSharedInformerFactory(cs, 0)
+		informer := factory.Core().V1().Secrets().Informer()
+
+		factory.Start(stopCh)
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			b.Fatal("failed to sync")
+		}
+
+		return informer
+	}
+}
+
+// startMetadata serves the objects with the fake metadata
+// client and starts a metadata-only Secrets informer
+func startMetadata(b *testing.B, objects []k8sruntime.Object) func(stopCh <-chan struct{}) cache.SharedIndexInformer {
+	scheme := k8sruntime.NewScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		b.Fatal(err)
+	}
+
+	mc := metadatafake.NewSimpleMetadataClient(scheme, objects...)
+
+	return func(stopCh <-chan struct{}) cache.SharedIndexInformer {
+		factory := metadatainformer.NewSharedInformerFactory(mc, 0)
+		informer := factory.ForResource(corev1.SchemeGroupVersion.WithResource("secrets")).Informer()
+
+		factory.Start(stopCh)
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			b.Fatal("failed to sync")
+		}
+
+		return informer
+	}
+}
+
+// fullSecrets returns the synthetic secrets
+func fullSecrets(count, payload int) []k8sruntime.Object {
+	res := make([]k8sruntime.Object, 0, count)
+	for i := 0; i < count; i++ {
+		res = append(res, &corev1.Secret{
+			ObjectMeta: objectMeta(i),
+			Type:       corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				"payload": make([]byte, payload),
+			},
+		})
+	}
+	return res
+}
+
+// metadataSecrets returns the metadata of the synthetic secrets
+func metadataSecrets(count int) []k8sruntime.Object {
+	res := make([]k8sruntime.Object, 0, count)
+	for i := 0; i < count; i++ {
+		res = append(res, &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: objectMeta(i),
+		})
+	}
+	return res
+}
+
+// objectMeta returns the metadata of the i-th synthetic secret
+func objectMeta(i int) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace: fmt.Sprintf("ns-%d", i%10),
+		Name:      fmt.Sprintf("secret-%d", i),
+		Labels:    map[string]string{"app": "benchmark"},
+	}
+}
+
+// heapInUse returns the heap in use after a full garbage collection
+func heapInUse() int64 {
+	runtime.GC()
+	runtime.GC()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.HeapAlloc)
+}
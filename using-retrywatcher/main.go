@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"time"
 
+	"github.com/lucasepe/using-client-go/pkg/checkpoint"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	"github.com/lucasepe/using-client-go/pkg/watchlist"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiWatch "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
@@ -19,21 +24,48 @@ import (
 //
 // this is our implementation of `cache.Watcher`
 type sentinel struct {
-	client      *kubernetes.Clientset
-	timeoutSecs int64
+	client        kubernetes.Interface
+	timeoutSecs   int64
+	labelSelector string
+	fieldSelector string
 }
 
 // newSentinel returns a new `sentinel` object that implements `cache.Watcher`
-func newSentinel(cs *kubernetes.Clientset, timeout int64) cache.Watcher {
-	return &sentinel{cs, timeout}
+func newSentinel(cs kubernetes.Interface, timeout int64, labelSelector, fieldSelector string) *sentinel {
+	return &sentinel{
+		client:        cs,
+		timeoutSecs:   timeout,
+		labelSelector: labelSelector,
+		fieldSelector: fieldSelector,
+	}
+}
+
+// WatchList returns the current namespaces as ADDED events, followed by
+// their changes; once its `Synced` channel is closed, the initial state
+// is complete and its resourceVersion is where the watch should resume
+// from, in order to not miss any event (a streaming list is used if the
+// server supports it, otherwise a List followed by a Watch)
+func (s *sentinel) WatchList(ctx context.Context) (*watchlist.Watcher, error) {
+	return watchlist.Start(ctx, s.client.CoreV1().RESTClient(), "", "namespaces",
+		metav1.ListOptions{
+			LabelSelector: s.labelSelector,
+			FieldSelector: s.fieldSelector,
+		})
 }
 
 // Watch begin a watch on namespaces resources
+//
+// the `RetryWatcher` calls this method on every restart passing the
+// last resourceVersion it has seen, so the options must be forwarded
+// otherwise events would be replayed or lost
 func (s *sentinel) Watch(options metav1.ListOptions) (apiWatch.Interface, error) {
+	opts := options
+	opts.TimeoutSeconds = &s.timeoutSecs
+	opts.LabelSelector = s.labelSelector
+	opts.FieldSelector = s.fieldSelector
+
 	return s.client.CoreV1().Namespaces().
-		Watch(context.Background(), metav1.ListOptions{
-			TimeoutSeconds: &s.timeoutSecs,
-		})
+		Watch(context.Background(), opts)
 }
 
 // just to be sure that `cache.Watcher` interface
@@ -41,6 +73,15 @@ func (s *sentinel) Watch(options metav1.ListOptions) (apiWatch.Interface, error)
 var _ cache.Watcher = (*sentinel)(nil)
 
 func main() {
+	labelSelector := flag.String("l", "", "label selector to filter namespaces")
+	fieldSelector := flag.String("field-selector", "", "field selector to filter namespaces")
+
+	checkpointFile := flag.String("checkpoint", "checkpoint.json", "file where the last processed resourceVersion is saved")
+	checkpointConfigMap := flag.String("checkpoint-configmap", "", "save the checkpoint in this ConfigMap (namespace/name) instead of a file")
+	checkpointInterval := flag.Duration("checkpoint-interval", 10*time.Second, "save the checkpoint at most once in this interval (on restart, at most this interval of events is replayed)")
+
+	flag.Parse()
+
 	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{},
@@ -57,45 +98,205 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Printf("---- Start watching namespaces ----\n")
+	// where the watch progress is persisted
+	var store checkpoint.Store = checkpoint.NewFileStore(*checkpointFile)
+	if len(*checkpointConfigMap) > 0 {
+		ns, name, err := cache.SplitMetaNamespaceKey(*checkpointConfigMap)
+		if err != nil {
+			panic(err)
+		}
+		store = checkpoint.NewConfigMapStore(cs, ns, name)
+	}
+
+	// not on every event: the latest checkpoint is saved at
+	// most once per interval, and on exit
+	throttled := checkpoint.Throttle(store, *checkpointInterval)
+	store = throttled
+	defer func() {
+		if err := throttled.Flush(context.Background()); err != nil {
+			panic(err)
+		}
+	}()
+
+	// canceled on SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
 
-	// create a `cache.Watcher` implementation using the `ClientSet``
-	watcher := newSentinel(cs, 50)
-	// create a `RetryWatcher` using initial
-	// version "1" and our specialized watcher
-	rw, err := watch.NewRetryWatcher("1", watcher)
+	// resume from the last saved checkpoint (if any)
+	cp, err := store.Load(ctx)
 	if err != nil {
 		panic(err)
 	}
 
+	// create a `cache.Watcher` implementation using the `ClientSet``
+	watcher := newSentinel(cs, 50, *labelSelector, *fieldSelector)
+
+	for {
+		// no resourceVersion to resume from (first run or 410 Gone)
+		if len(cp.ResourceVersion) == 0 {
+			err := relist(ctx, watcher, cp, store)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		fmt.Printf("---- Start watching namespaces (resourceVersion: %s) ----\n", cp.ResourceVersion)
+
+		err := watchFrom(ctx, watcher, cp, store)
+		if ctx.Err() != nil {
+			// the checkpoint of the last processed event is saved
+			// (flushed on return): the next run resumes from there
+			fmt.Printf("---- Stopped (resourceVersion: %s) ----\n", cp.ResourceVersion)
+			return
+		}
+		if !errors.IsResourceExpired(err) && !errors.IsGone(err) {
+			panic(err)
+		}
+
+		// the checkpoint resourceVersion is too old, a new List is needed
+		fmt.Printf("---- %v ----\n", err)
+		cp.ResourceVersion = ""
+	}
+}
+
+// relist gets the current namespaces and compares them against the
+// known ones, printing what changed while we were not watching
+func relist(ctx context.Context, s *sentinel, cp *checkpoint.Checkpoint, store checkpoint.Store) error {
+	wl, err := s.WatchList(ctx)
+	if err != nil {
+		return err
+	}
+	// we only need the initial state: the `RetryWatcher` does the rest
+	defer wl.Stop()
+
+	current := map[string]string{}
+	byName := map[string]*corev1.Namespace{}
+
+	// collect the initial ADDED events until the sync is complete
+	for synced := false; !synced; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-wl.Synced():
+			synced = true
+
+		case event, ok := <-wl.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch closed before the initial sync")
+			}
+
+			if event.Type == apiWatch.Error {
+				return errors.FromObject(event.Object)
+			}
+
+			// skip the regular bookmarks
+			el, ok := event.Object.(*corev1.Namespace)
+			if !ok || event.Type == apiWatch.Bookmark {
+				continue
+			}
+
+			current[el.Name] = el.GetResourceVersion()
+			byName[el.Name] = el
+		}
+	}
+
+	fmt.Printf("---- Found %d namespaces (resourceVersion: %s, streaming: %t) ----\n",
+		len(current), wl.ResourceVersion(), wl.Streaming())
+
+	diff := cp.Diff(current)
+	for _, name := range diff.Added {
+		printEvent(apiWatch.Added, byName[name])
+	}
+	for _, name := range diff.Modified {
+		printEvent(apiWatch.Modified, byName[name])
+	}
+	for _, name := range diff.Deleted {
+		printEvent(apiWatch.Deleted, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		})
+	}
+
+	cp.ResourceVersion = wl.ResourceVersion()
+	cp.Objects = current
+
+	return store.Save(ctx, cp)
+}
+
+// pause is the time to wait after each processed event
+var pause = 5 * time.Second
+
+// watchFrom watches namespaces starting from the checkpoint resourceVersion
+// and saves the checkpoint after each event; it returns when the watch
+// cannot be resumed anymore (i.e. the resourceVersion is too old) or
+// the context is done (the event being processed is completed first)
+func watchFrom(ctx context.Context, s cache.Watcher, cp *checkpoint.Checkpoint, store checkpoint.Store) error {
+	// create a `RetryWatcher` starting from the checkpoint
+	// resourceVersion and using our specialized watcher
+	rw, err := watch.NewRetryWatcher(cp.ResourceVersion, s)
+	if err != nil {
+		return err
+	}
+	defer rw.Stop()
+
 	// process incoming event notifications
 	for {
 		// grab the event object
-		event, ok := <-rw.ResultChan()
-		if !ok {
-			panic(fmt.Errorf("closed channel"))
+		var event apiWatch.Event
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-rw.ResultChan():
+			if !ok {
+				return fmt.Errorf("closed channel")
+			}
+			event = ev
+		}
+
+		// the `RetryWatcher` gives up on errors like 410 Gone
+		// (resourceVersion too old): a new List is needed
+		if event.Type == apiWatch.Error {
+			return errors.FromObject(event.Object)
 		}
 
 		// cast to namespace
 		ns, ok := event.Object.(*corev1.Namespace)
 		if !ok {
-			panic(fmt.Errorf("invalid type '%T'", event.Object))
+			return fmt.Errorf("invalid type '%T'", event.Object)
 		}
 
-		// skip events older then five minutes
-		creationTime := ns.GetCreationTimestamp().Time
-		fiveMinsAgo := time.Now().Add(-5 * time.Minute)
-		if event.Type == apiWatch.Added && creationTime.Before(fiveMinsAgo) {
-			// fmt.Printf(">> skip older events (creationTime: %s, currentTime: %s)\n",
-			//	creationTime.Format(time.RFC3339), time.Now().Format(time.RFC3339))
-			continue
+		printEvent(event.Type, ns)
+
+		// keep track of what we have processed...
+		cp.ResourceVersion = ns.GetResourceVersion()
+		if event.Type == apiWatch.Deleted {
+			delete(cp.Objects, ns.Name)
+		} else {
+			cp.Objects[ns.Name] = ns.GetResourceVersion()
 		}
 
-		// print some info about the event
-		fmt.Printf("%s %s (createdAt: %s, phase: %s)\n",
-			event.Type, ns.Name, creationTime.Format(time.RFC3339), ns.Status.Phase)
+		// ...and persist it, to resume from here on restart (even if we
+		// are stopping: the event has been processed); a throttled store
+		// writes only the latest checkpoint, once in a while
+		if err := store.Save(context.Background(), cp); err != nil {
+			return err
+		}
 
-		// sleep a bit
-		time.Sleep(5 * time.Second)
+		// sleep a bit (or stop)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
 	}
 }
+
+// printEvent prints some info about the event
+func printEvent(et apiWatch.EventType, ns *corev1.Namespace) {
+	fmt.Printf("%s %s (createdAt: %s, phase: %s, resourceVersion: %s)\n",
+		et, ns.Name, ns.GetCreationTimestamp().Format(time.RFC3339),
+		ns.Status.Phase, ns.GetResourceVersion())
+}
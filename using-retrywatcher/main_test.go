@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/checkpoint"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiWatch "k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// memoryStore remembers every saved resourceVersion
+type memoryStore struct {
+	mu    sync.Mutex
+	saved []string
+}
+
+func (m *memoryStore) Load(context.Context) (*checkpoint.Checkpoint, error) {
+	return checkpoint.New(), nil
+}
+
+func (m *memoryStore) Save(_ context.Context, cp *checkpoint.Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved = append(m.saved, cp.ResourceVersion)
+	return nil
+}
+
+func (m *memoryStore) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.saved...)
+}
+
+func namespaceEvent(et apiWatch.EventType, name string, rv int) apiWatch.Event {
+	return apiWatch.Event{Type: et, Object: &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: strconv.Itoa(rv)},
+	}}
+}
+
+// fakeServer serves the events after the requested resourceVersion
+// and closes each watch after a couple of them, forcing the
+// `RetryWatcher` to restart
+type fakeServer struct {
+	events []apiWatch.Event
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeServer) watch(options metav1.ListOptions) (apiWatch.Interface, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, options.ResourceVersion)
+	f.mu.Unlock()
+
+	from, err := strconv.Atoi(options.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []apiWatch.Event
+	for _, el := range f.events {
+		rv, _ := strconv.Atoi(el.Object.(*corev1.Namespace).ResourceVersion)
+		if rv > from {
+			pending = append(pending, el)
+		}
+	}
+
+	w := apiWatch.NewFake()
+	go func() {
+		for i, el := range pending {
+			if i == 2 {
+				// more events to come: the watch is closed
+				w.Stop()
+				return
+			}
+			w.Action(el.Type, el.Object)
+		}
+		// no more events: the watch is left open
+	}()
+
+	return w, nil
+}
+
+func (f *fakeServer) watchRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func TestWatchFromSurvivesRestarts(t *testing.T) {
+	pause = 0
+
+	srv := &fakeServer{events: []apiWatch.Event{
+		namespaceEvent(apiWatch.Added, "a", 11),
+		namespaceEvent(apiWatch.Added, "b", 12),
+		namespaceEvent(apiWatch.Modified, "a", 13),
+		namespaceEvent(apiWatch.Added, "c", 14),
+		namespaceEvent(apiWatch.Deleted, "b", 15),
+	}}
+
+	// the initial List returned resourceVersion 10
+	cp := checkpoint.New()
+	cp.ResourceVersion = "10"
+
+	store := &memoryStore{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- watchFrom(ctx, &cache.ListWatch{WatchFunc: srv.watch}, cp, store)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(store.list()) < len(srv.events) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, saved resourceVersions: %v", store.list())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got %v, expected %v", err, context.Canceled)
+	}
+
+	// every event has been processed exactly once
+	if expected := []string{"11", "12", "13", "14", "15"}; !reflect.DeepEqual(store.list(), expected) {
+		t.Fatalf("saved resourceVersions %v, expected %v", store.list(), expected)
+	}
+
+	// each restart resumed from the last processed event
+	if expected := []string{"10", "12", "14"}; !reflect.DeepEqual(srv.watchRequests(), expected) {
+		t.Fatalf("watches started at %v, expected %v", srv.watchRequests(), expected)
+	}
+
+	if expected := map[string]string{"a": "13", "c": "14"}; !reflect.DeepEqual(cp.Objects, expected) {
+		t.Fatalf("known objects %v, expected %v", cp.Objects, expected)
+	}
+}
+
+func TestSentinelForwardsOptions(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+
+	var got k8stesting.WatchRestrictions
+	cs.PrependWatchReactor("namespaces", func(action k8stesting.Action) (bool, apiWatch.Interface, error) {
+		got = action.(k8stesting.WatchAction).GetWatchRestrictions()
+		return true, apiWatch.NewFake(), nil
+	})
+
+	s := newSentinel(cs, 50, "team=a", "status.phase=Active")
+
+	w, err := s.Watch(metav1.ListOptions{ResourceVersion: "42", AllowWatchBookmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if got.ResourceVersion != "42" {
+		t.Fatalf("the RetryWatcher resourceVersion was not forwarded: %q", got.ResourceVersion)
+	}
+	if got.Labels.String() != "team=a" || got.Fields.String() != "status.phase=Active" {
+		t.Fatalf("the selectors were not applied: %s, %s", got.Labels, got.Fields)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lucasepe/using-client-go/pkg/objdiff"
+	"github.com/lucasepe/using-client-go/pkg/resource"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// go run main.go -o diff deploy
+// go run main.go -A -o json pods
+func main() {
+	namespace := flag.String("n", "", "watch the resources in this namespace (defaults to the kubeconfig one)")
+	allNamespaces := flag.Bool("A", false, "watch the resources in all namespaces")
+	labelSelector := flag.String("l", "", "label selector to filter the resources")
+	output := flag.String("o", "line", "output format: line, json or diff")
+
+	flag.Usage = func() {
+		name := os.Args[0]
+		if strings.Contains(name, "go-build") {
+			name = "go run main.go"
+		}
+
+		w := flag.CommandLine.Output()
+		fmt.Fprintf(w, "Usage:  %s <kind or resource name (i.e. pods, deploy, pizzas, exp)>\n\n", name)
+
+		fmt.Fprintf(w, "Flags:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+
+	if len(*namespace) == 0 {
+		ns, _, err := configLoader.Namespace()
+		if err != nil {
+			panic(err)
+		}
+		*namespace = ns
+	}
+
+	cfg, err := configLoader.ClientConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// a RESTMapper backed by the discovery client (cached in memory)
+	// that knows about the short names (i.e. deploy, exp) as well
+	mapper := resource.NewMapper(dc)
+
+	mapping, err := resource.Resolve(mapper, flag.Args()[0])
+	if err != nil {
+		panic(err)
+	}
+
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	var ri dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && !*allNamespaces {
+		ri = dyn.Resource(mapping.Resource).Namespace(*namespace)
+	}
+
+	watcher, err := ri.Watch(context.Background(), metav1.ListOptions{
+		LabelSelector: *labelSelector,
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer watcher.Stop()
+
+	var print printer
+	switch *output {
+	case "line":
+		print = printLine
+	case "json":
+		print = printJSON
+	case "diff":
+		print = newDiffPrinter()
+	default:
+		panic(fmt.Errorf("unknown output format %q", *output))
+	}
+
+	fmt.Fprintf(os.Stderr, "---- Watching %s (%s) ----\n",
+		mapping.Resource.GroupResource(), mapping.GroupVersionKind)
+
+	for event := range watcher.ResultChan() {
+		if event.Type == watch.Error {
+			panic(errors.FromObject(event.Object))
+		}
+
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		print(event.Type, obj)
+	}
+}
+
+// printer knows how to print a watch event
+type printer func(et watch.EventType, obj *unstructured.Unstructured)
+
+// printLine prints one line for each event
+func printLine(et watch.EventType, obj *unstructured.Unstructured) {
+	fmt.Printf("%-8s %s %s (resourceVersion: %s)\n",
+		et, obj.GetKind(), resource.DisplayName(obj), obj.GetResourceVersion())
+}
+
+// printJSON prints each event as a JSON line
+func printJSON(et watch.EventType, obj *unstructured.Unstructured) {
+	res, err := json.Marshal(map[string]interface{}{
+		"type":   et,
+		"object": obj.Object,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("%s\n", res)
+}
+
+// newDiffPrinter returns a printer that keeps the last seen version
+// of each object and prints the changed fields on modifications
+func newDiffPrinter() printer {
+	tracker := objdiff.NewTracker(objdiff.NoisePaths...)
+
+	return func(et watch.EventType, obj *unstructured.Unstructured) {
+		printLine(et, obj)
+
+		changes, err := tracker.Observe(et, obj)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+
+		if err := objdiff.Fprint(os.Stdout, changes, false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/checkpoint"
+	"github.com/lucasepe/using-client-go/pkg/forwarder"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/klog/v2"
+)
+
+// go run main.go -sink http://localhost:8080/events
+func main() {
+	sinkURL := flag.String("sink", "", "URL where the CloudEvents batches are POSTed")
+	stateDir := flag.String("state-dir", ".forwarder", "directory holding the checkpoints and the spool")
+	spoolMaxBytes := flag.Int64("spool-max-bytes", 10<<20, "maximum size of the on-disk spool")
+	batchSize := flag.Int("batch-size", 50, "maximum number of events in a batch")
+	flushInterval := flag.Duration("flush-interval", 5*time.Second, "maximum time an event waits for its batch")
+	checkpointInterval := flag.Duration("checkpoint-interval", 5*time.Second, "save the checkpoints at most once in this interval (on restart, at most this interval of events is sent again)")
+
+	klog.InitFlags(nil)
+
+	flag.Parse()
+
+	if len(*sinkURL) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+
+	cfg, err := configLoader.ClientConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	spool, err := forwarder.NewSpool(filepath.Join(*stateDir, "spool"), *spoolMaxBytes)
+	if err != nil {
+		panic(err)
+	}
+
+	fwd := forwarder.New(forwarder.Options{
+		SinkURL:       *sinkURL,
+		BatchSize:     *batchSize,
+		FlushInterval: *flushInterval,
+		Spool:         spool,
+	})
+
+	// CTRL+C flushes the pending batch before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sources := []*source{
+		newSource(dc, schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, "Namespace", *stateDir, *checkpointInterval),
+		newSource(dc, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", *stateDir, *checkpointInterval),
+	}
+
+	var wg sync.WaitGroup
+	for _, el := range sources {
+		wg.Add(1)
+		go func(s *source) {
+			defer wg.Done()
+			if err := s.run(ctx, fwd); err != nil && ctx.Err() == nil {
+				klog.ErrorS(err, "Watch failed", "resource", s.gvr.Resource)
+				stop()
+			}
+		}(el)
+	}
+
+	fwd.Run(ctx)
+	wg.Wait()
+
+	// the last acknowledged events, not saved yet
+	for _, el := range sources {
+		if err := el.store.Flush(context.Background()); err != nil {
+			klog.ErrorS(err, "Saving checkpoint failed", "resource", el.gvr.Resource)
+		}
+	}
+}
+
+// source watches a resource and forwards its events; the checkpoint
+// advances only when the forwarder acknowledges the events
+type source struct {
+	dc    dynamic.Interface
+	gvr   schema.GroupVersionResource
+	kind  string
+	store *checkpoint.Throttled
+
+	// guards the checkpoint, updated by the forwarder acks
+	mu sync.Mutex
+	cp *checkpoint.Checkpoint
+}
+
+// newSource returns a `source` whose checkpoint is saved in the
+// state directory, at most once per interval
+func newSource(dc dynamic.Interface, gvr schema.GroupVersionResource, kind, stateDir string, interval time.Duration) *source {
+	store := checkpoint.NewFileStore(filepath.Join(stateDir, gvr.Resource+".checkpoint.json"))
+
+	return &source{
+		dc:    dc,
+		gvr:   gvr,
+		kind:  kind,
+		store: checkpoint.Throttle(store, interval),
+	}
+}
+
+// run watches the resource starting from the last acknowledged event
+func (s *source) run(ctx context.Context, fwd *forwarder.Forwarder) error {
+	cp, err := s.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	s.cp = cp
+
+	// where the watch is, not necessarily acknowledged yet
+	rv := cp.ResourceVersion
+
+	for ctx.Err() == nil {
+		// first run or 410 Gone
+		if len(rv) == 0 {
+			if rv, err = s.relist(ctx, fwd); err != nil {
+				return err
+			}
+		}
+
+		rv, err = s.watch(ctx, fwd, rv)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relist lists the resource and forwards the differences from the
+// known objects; it returns the resourceVersion to watch from
+func (s *source) relist(ctx context.Context, fwd *forwarder.Forwarder) (string, error) {
+	list, err := s.dc.Resource(s.gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	current := map[string]string{}
+	byKey := map[string]*unstructured.Unstructured{}
+	for i := range list.Items {
+		el := &list.Items[i]
+		key, _ := cache.MetaNamespaceKeyFunc(el)
+		current[key] = el.GetResourceVersion()
+		byKey[key] = el
+	}
+
+	s.mu.Lock()
+	diff := s.cp.Diff(current)
+	s.mu.Unlock()
+
+	var events []watch.Event
+	for _, key := range diff.Added {
+		events = append(events, watch.Event{Type: watch.Added, Object: byKey[key]})
+	}
+	for _, key := range diff.Modified {
+		events = append(events, watch.Event{Type: watch.Modified, Object: byKey[key]})
+	}
+	for _, key := range diff.Deleted {
+		events = append(events, watch.Event{Type: watch.Deleted, Object: s.tombstone(key)})
+	}
+
+	// once all the differences are delivered, the
+	// list is the new starting point of the checkpoint
+	done := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.cp.ResourceVersion = list.GetResourceVersion()
+		s.cp.Objects = current
+		s.save()
+	}
+
+	if len(events) == 0 {
+		done()
+		return list.GetResourceVersion(), nil
+	}
+
+	for i, el := range events {
+		ack := func() {}
+		if i == len(events)-1 {
+			ack = done
+		}
+		if err := s.forward(ctx, fwd, el, ack); err != nil {
+			return "", err
+		}
+	}
+
+	return list.GetResourceVersion(), nil
+}
+
+// watch forwards the events starting from the specified resourceVersion;
+// it returns the resourceVersion reached or "" if it is too old
+func (s *source) watch(ctx context.Context, fwd *forwarder.Forwarder, rv string) (string, error) {
+	rw, err := watchtools.NewRetryWatcher(rv, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return s.dc.Resource(s.gvr).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rw.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, nil
+
+		case event, ok := <-rw.ResultChan():
+			if !ok {
+				return rv, nil
+			}
+
+			if event.Type == watch.Error {
+				err := errors.FromObject(event.Object)
+				if errors.IsResourceExpired(err) || errors.IsGone(err) {
+					klog.InfoS("Watch expired, listing again", "resource", s.gvr.Resource)
+					return "", nil
+				}
+				return "", err
+			}
+
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			if err := s.forward(ctx, fwd, event, s.ack(event.Type, obj)); err != nil {
+				return "", err
+			}
+			rv = obj.GetResourceVersion()
+		}
+	}
+}
+
+// forward converts and enqueues an event
+func (s *source) forward(ctx context.Context, fwd *forwarder.Forwarder, event watch.Event, ack func()) error {
+	// the source is the API path of the resource
+	prefix := "/apis"
+	if len(s.gvr.Group) == 0 {
+		prefix = "/api"
+	}
+
+	ce, err := forwarder.FromWatchEvent(fmt.Sprintf("%s/%s/%s", prefix, s.gvr.GroupVersion(), s.gvr.Resource), event)
+	if err != nil {
+		return err
+	}
+	return fwd.Enqueue(ctx, ce, ack)
+}
+
+// ack returns the function that records the event in the checkpoint
+func (s *source) ack(et watch.EventType, obj *unstructured.Unstructured) func() {
+	key, _ := cache.MetaNamespaceKeyFunc(obj)
+	rv := obj.GetResourceVersion()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.cp.ResourceVersion = rv
+		if et == watch.Deleted {
+			delete(s.cp.Objects, key)
+		} else {
+			s.cp.Objects[key] = rv
+		}
+		s.save()
+	}
+}
+
+// save persists the checkpoint (or schedules it), the caller must hold the lock
+func (s *source) save() {
+	if err := s.store.Save(context.Background(), s.cp); err != nil {
+		klog.ErrorS(err, "Saving checkpoint failed", "resource", s.gvr.Resource)
+	}
+}
+
+// tombstone returns the last known state of a deleted object: just its name
+func (s *source) tombstone(key string) runtime.Object {
+	ns, name, _ := cache.SplitMetaNamespaceKey(key)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(s.gvr.GroupVersion().String())
+	obj.SetKind(s.kind)
+	obj.SetNamespace(ns)
+	obj.SetName(name)
+	return obj
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/checkpoint"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestAcksAreSavedOnceInAWhile(t *testing.T) {
+	dir := t.TempDir()
+	s := newSource(nil, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "Pod", dir, time.Hour)
+	s.cp = checkpoint.New()
+
+	for i := 1; i <= 100; i++ {
+		obj := &unstructured.Unstructured{}
+		obj.SetNamespace("default")
+		obj.SetName("pod-" + strconv.Itoa(i%10))
+		obj.SetResourceVersion(strconv.Itoa(i))
+
+		s.ack(watch.Modified, obj)()
+	}
+
+	saved := checkpoint.NewFileStore(filepath.Join(dir, "pods.checkpoint.json"))
+
+	// only the first ack has been written
+	cp, err := saved.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.ResourceVersion != "1" {
+		t.Fatalf("got resourceVersion %q, expected 1", cp.ResourceVersion)
+	}
+
+	// on exit, the last one
+	if err := s.store.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = saved.Load(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.ResourceVersion != "100" || len(cp.Objects) != 10 || cp.Objects["default/pod-0"] != "100" {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+}
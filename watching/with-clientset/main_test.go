@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// events returns the events recorded so far
+func events(rec *record.FakeRecorder) []string {
+	var res []string
+	for {
+		select {
+		case el := <-rec.Events:
+			res = append(res, el)
+		default:
+			return res
+		}
+	}
+}
+
+func TestLabelRecordsAnEvent(t *testing.T) {
+	ns := namespace("demo", nil)
+	cs := fake.NewSimpleClientset(ns)
+	rec := record.NewFakeRecorder(10)
+
+	pd, err := label(cs.CoreV1().Namespaces(), rec, policy.Default(), metav1.PatchOptions{FieldManager: "my-cool-app"}, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"metadata":{"labels":{"modified-by":"lucasepe"}}}`
+	if string(pd) != expected {
+		t.Fatalf("got patch %s, expected %s", pd, expected)
+	}
+
+	got, err := cs.CoreV1().Namespaces().Get(context.TODO(), "demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Labels["modified-by"] != "lucasepe" {
+		t.Fatalf("the namespace was not patched: %v", got.Labels)
+	}
+
+	evts := events(rec)
+	if len(evts) != 1 || evts[0] != "Normal Labeled Policy applied by my-cool-app: "+expected {
+		t.Fatalf("got events %q", evts)
+	}
+}
+
+func TestLabelCompliantOrDryRun(t *testing.T) {
+	compliant := namespace("compliant", map[string]string{"modified-by": "lucasepe"})
+	other := namespace("other", nil)
+
+	cs := fake.NewSimpleClientset(compliant, other)
+	rec := record.NewFakeRecorder(10)
+
+	pd, err := label(cs.CoreV1().Namespaces(), rec, policy.Default(), metav1.PatchOptions{}, compliant)
+	if err != nil || pd != nil {
+		t.Fatalf("got %s, %v, expected no patch", pd, err)
+	}
+
+	// patched (the API server persists nothing), but no Event
+	po := metav1.PatchOptions{DryRun: []string{metav1.DryRunAll}}
+	pd, err = label(cs.CoreV1().Namespaces(), rec, policy.Default(), po, other)
+	if err != nil || pd == nil {
+		t.Fatalf("got %s, %v, expected a patch", pd, err)
+	}
+
+	patches := 0
+	for _, el := range cs.Actions() {
+		if el.GetVerb() != "patch" {
+			continue
+		}
+		patches++
+		if name := el.(k8stesting.PatchAction).GetName(); name != "other" {
+			t.Fatalf("unexpected patch of %s", name)
+		}
+	}
+	if patches != 1 {
+		t.Fatalf("got %d patches, expected 1", patches)
+	}
+
+	if evts := events(rec); len(evts) != 0 {
+		t.Fatalf("unexpected events %q", evts)
+	}
+}
@@ -2,18 +2,36 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-
+	"os"
+	"time"
+
+	"github.com/lucasepe/using-client-go/pkg/objdiff"
+	"github.com/lucasepe/using-client-go/pkg/pipeline"
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	"github.com/lucasepe/using-client-go/pkg/recorder"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 func main() {
+	asPatch := flag.Bool("patch", false, "print the changes of modified namespaces as a JSON Patch")
+	policyFile := flag.String("policy", "", "YAML file with the labelling policy (default: add the label modified-by=lucasepe)")
+	dryRun := flag.Bool("dry-run", false, "validate the patches on the API server without persisting them")
+
+	flag.Parse()
+
 	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{},
@@ -29,6 +47,16 @@ func main() {
 		panic(err.Error())
 	}
 
+	// the Events are written using a typed client
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	// records the Events about the namespaces we patch
+	rec := recorder.New(cs, scheme.Scheme, "namespace-watcher")
+	defer rec.Flush(5 * time.Second)
+
 	gvr := schema.GroupVersionResource{
 		Version:  "v1",
 		Resource: "namespaces",
@@ -52,24 +80,66 @@ func main() {
 		panic(err)
 	}
 
-	// the patch data, just add a custom label
-	pd := []byte(`{"metadata":{"labels":{"modified-by":"lucasepe"}}}`)
-
-	// the patch type
-	pt := types.MergePatchType
+	// the labelling policy tells how to patch the namespaces
+	// (the templated objects are left to the namespace-policy controller)
+	pol := policy.Default()
+	if len(*policyFile) > 0 {
+		pol, err = policy.Load(*policyFile)
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	// who did this patch?
 	po := metav1.PatchOptions{
 		FieldManager: "my-cool-app",
 	}
 
+	// validate the patches without persisting them
+	if *dryRun {
+		po.DryRun = []string{metav1.DryRunAll}
+	}
+
+	// keep track of the last version of each namespace
+	// in order to show what changed on modifications
+	tracker := objdiff.NewTracker(objdiff.NoisePaths...)
+
+	// keep only the events we are interested in (errors
+	// included, not to miss them), skipping duplicates
+	events := pipeline.New(watcher,
+		pipeline.EventTypes(watch.Added, watch.Modified, watch.Deleted, watch.Error),
+		pipeline.Dedupe(),
+	)
+	defer events.Stop()
+
 	// iterate all the events
-	for event := range watcher.ResultChan() {
+	for event := range events.ResultChan() {
+		// the watch failed (i.e. 410 Gone: it expired): errors
+		// carry a Status, not a Namespace, and end the watch
+		if event.Type == watch.Error {
+			panic(errors.FromObject(event.Object))
+		}
+
 		// retrieve the Namespace
 		item := event.Object.(*unstructured.Unstructured)
 
+		changes, err := tracker.Observe(event.Type, item)
+		if err != nil {
+			panic(err)
+		}
+
 		switch event.Type {
 
+		// when a namespace is modified...
+		case watch.Modified:
+			// show what changed (if anything interesting)
+			if len(changes) > 0 {
+				fmt.Printf("~ '%s' %v\n", item.GetName(), event.Type)
+				if err := objdiff.Fprint(os.Stdout, changes, *asPatch); err != nil {
+					panic(err)
+				}
+			}
+
 		// when a namespace is deleted...
 		case watch.Deleted:
 			// let's say hello!
@@ -79,13 +149,48 @@ func main() {
 		case watch.Added:
 			fmt.Printf("+ '%s' %v  ", item.GetName(), event.Type)
 
-			// try to patch it!
-			_, err = nsr.Patch(context.TODO(), item.GetName(), pt, pd, po)
+			pd, err := label(nsr, rec, pol, po, item)
 			if err != nil {
 				panic(err)
 			}
 
-			fmt.Println(" ...patched!")
+			switch {
+			case pd == nil:
+				fmt.Println(" ...already compliant!")
+			case *dryRun:
+				fmt.Printf(" ...patched (dry run): %s\n", pd)
+			default:
+				fmt.Println(" ...patched!")
+			}
 		}
 	}
 }
+
+// label applies the policy to the added namespace and, unless it is a
+// dry run, records an Event about it; it returns the applied patch (nil
+// if the namespace was already compliant)
+func label(nsr dynamic.ResourceInterface, rec record.EventRecorder, pol *policy.Policy,
+	po metav1.PatchOptions, item *unstructured.Unstructured) ([]byte, error) {
+	// what is missing according to the policy?
+	pd, err := pol.Patch(item)
+	if err != nil || pd == nil {
+		return nil, err
+	}
+
+	// try to patch it!
+	_, err = nsr.Patch(context.TODO(), item.GetName(), types.MergePatchType, pd, po)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing changed: nothing to tell
+	if len(po.DryRun) > 0 {
+		return pd, nil
+	}
+
+	// tell everyone what we did
+	rec.Eventf(item, corev1.EventTypeNormal, "Labeled",
+		"Policy applied by %s: %s", po.FieldManager, pd)
+
+	return pd, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var namespaces = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+func namespace(name string, labels map[string]string) *unstructured.Unstructured {
+	res := &unstructured.Unstructured{}
+	res.SetAPIVersion("v1")
+	res.SetKind("Namespace")
+	res.SetName(name)
+	res.SetLabels(labels)
+	return res
+}
+
+// events returns the events recorded so far
+func events(rec *record.FakeRecorder) []string {
+	var res []string
+	for {
+		select {
+		case el := <-rec.Events:
+			res = append(res, el)
+		default:
+			return res
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	demo := namespace("demo", nil)
+	compliant := namespace("compliant", map[string]string{"modified-by": "lucasepe"})
+
+	dc := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), demo, compliant)
+	nsr := dc.Resource(namespaces)
+	rec := record.NewFakeRecorder(10)
+	po := metav1.PatchOptions{FieldManager: "my-cool-app"}
+
+	pd, err := label(nsr, rec, policy.Default(), po, compliant)
+	if err != nil || pd != nil {
+		t.Fatalf("got %s, %v, expected no patch", pd, err)
+	}
+
+	pd, err = label(nsr, rec, policy.Default(), po, demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := nsr.Get(context.TODO(), "demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetLabels()["modified-by"] != "lucasepe" {
+		t.Fatalf("the namespace was not patched: %v", got.GetLabels())
+	}
+
+	// only about the patched namespace
+	evts := events(rec)
+	if len(evts) != 1 || evts[0] != "Normal Labeled Policy applied by my-cool-app: "+string(pd) {
+		t.Fatalf("got events %q", evts)
+	}
+
+	// a dry run tells nothing
+	po.DryRun = []string{metav1.DryRunAll}
+	if _, err := label(nsr, rec, policy.Default(), po, namespace("demo", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if evts := events(rec); len(evts) != 0 {
+		t.Fatalf("unexpected events %q", evts)
+	}
+}
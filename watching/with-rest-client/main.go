@@ -2,19 +2,35 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/lucasepe/using-client-go/pkg/checkpoint"
+	"github.com/lucasepe/using-client-go/pkg/objdiff"
+	"github.com/lucasepe/using-client-go/pkg/pipeline"
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	"github.com/lucasepe/using-client-go/pkg/recorder"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 func main() {
+	asPatch := flag.Bool("patch", false, "print the changes of modified namespaces as a JSON Patch")
+	policyFile := flag.String("policy", "", "YAML file with the labelling policy (default: add the label modified-by=lucasepe)")
+	dryRun := flag.Bool("dry-run", false, "validate the patches on the API server without persisting them")
+
+	flag.Parse()
+
 	configLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(),
 		&clientcmd.ConfigOverrides{},
@@ -25,6 +41,16 @@ func main() {
 		panic(err)
 	}
 
+	// the Events are written using a typed client
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	// records the Events about the namespaces we patch
+	rec := recorder.New(cs, scheme.Scheme, "namespace-watcher")
+	defer rec.Flush(5 * time.Second)
+
 	cfg.APIPath = "/api"
 	cfg.GroupVersion = &corev1.SchemeGroupVersion
 	cfg.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
@@ -34,61 +60,244 @@ func main() {
 		panic(err.Error())
 	}
 
-	// utility function to create a int64 pointer
-	i64Ptr := func(i int64) *int64 { return &i }
+	// the labelling policy tells how to patch the namespaces
+	// (the templated objects are left to the namespace-policy controller)
+	pol := policy.Default()
+	if len(*policyFile) > 0 {
+		pol, err = policy.Load(*policyFile)
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	opts := metav1.ListOptions{
-		TimeoutSeconds: i64Ptr(120),
-		Watch:          true,
+	// who did this patch?
+	po := metav1.PatchOptions{
+		FieldManager: "my-cool-app",
 	}
 
-	watcher, err := rc.Get().Resource("namespaces").
-		VersionedParams(&opts, scheme.ParameterCodec).
-		Timeout(time.Duration(*opts.TimeoutSeconds)).
-		Watch(context.TODO())
-	if err != nil {
-		panic(err)
+	// validate the patches without persisting them
+	if *dryRun {
+		po.DryRun = []string{metav1.DryRunAll}
 	}
 
-	// the patch data, just add a custom label
-	pd := []byte(`{"metadata":{"labels":{"modified-by":"lucasepe"}}}`)
+	// keep track of the last version of each namespace
+	// in order to show what changed on modifications
+	tracker := objdiff.NewTracker(objdiff.NoisePaths...)
 
-	// the patch type
-	pt := types.MergePatchType
+	// keep track of the known namespaces (name => resourceVersion)
+	// to find out what we missed when the watch expires
+	known := checkpoint.New()
 
-	// who did this patch?
-	po := metav1.PatchOptions{
-		FieldManager: "my-cool-app",
-	}
+	// handle is the business logic, called for each namespace event
+	handle := func(et watch.EventType, item *corev1.Namespace) {
+		if et == watch.Deleted {
+			delete(known.Objects, item.GetName())
+		} else {
+			known.Objects[item.GetName()] = item.GetResourceVersion()
+		}
 
-	// iterate all the events
-	for event := range watcher.ResultChan() {
-		// retrieve the Namespace
-		item := event.Object.(*corev1.Namespace)
+		changes, err := tracker.Observe(et, item)
+		if err != nil {
+			panic(err)
+		}
+
+		switch et {
 
-		switch event.Type {
+		// when a namespace is modified...
+		case watch.Modified:
+			// show what changed (if anything interesting)
+			if len(changes) > 0 {
+				fmt.Printf("~ '%s' %v\n", item.GetName(), et)
+				if err := objdiff.Fprint(os.Stdout, changes, *asPatch); err != nil {
+					panic(err)
+				}
+			}
 
 		// when a namespace is deleted...
 		case watch.Deleted:
 			// let's say hello!
-			fmt.Printf("- '%s' %v ...bye bye\n", item.GetName(), event.Type)
+			fmt.Printf("- '%s' %v ...bye bye\n", item.GetName(), et)
 
 		// when a namespace is added...
 		case watch.Added:
-			fmt.Printf("+ '%s' %v  ", item.GetName(), event.Type)
-
-			// try to patch it!
-			err = rc.Patch(pt).Resource("namespaces").
-				Name(item.Name).
-				VersionedParams(&po, scheme.ParameterCodec).
-				Body(pd).
-				Do(context.TODO()).
-				Error()
+			fmt.Printf("+ '%s' %v  ", item.GetName(), et)
+
+			pd, err := label(rc, rec, pol, po, item)
 			if err != nil {
 				panic(err)
 			}
 
-			fmt.Println(" ...patched!")
+			switch {
+			case pd == nil:
+				fmt.Println(" ...already compliant!")
+			case *dryRun:
+				fmt.Printf(" ...patched (dry run): %s\n", pd)
+			default:
+				fmt.Println(" ...patched!")
+			}
+		}
+	}
+
+	// the last resourceVersion we have seen; the first watch
+	// starts from scratch: all the namespaces will be ADDED
+	var rv string
+
+	for {
+		rv, err = watchNamespaces(rc, rv, 120, handle)
+		if err == nil {
+			// the watch timed out (or the server closed it):
+			// let's start again from where we left off
+			continue
+		}
+
+		// temporary server side errors: retry in a bit
+		if errors.IsTimeout(err) || errors.IsServerTimeout(err) ||
+			errors.IsInternalError(err) || errors.IsTooManyRequests(err) {
+			fmt.Printf("%v ...retrying\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if !errors.IsResourceExpired(err) && !errors.IsGone(err) {
+			panic(err)
+		}
+
+		// our resourceVersion is too old: list again and
+		// replay what happened meanwhile, then watch from there
+		fmt.Printf("%v ...listing again\n", err)
+
+		rv, err = relistNamespaces(rc, known, handle)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// watchNamespaces watches namespaces starting from the specified
+// resourceVersion, calling handle for each event; it returns the last
+// resourceVersion seen when the watch ends or fails
+func watchNamespaces(rc *rest.RESTClient, rv string, timeoutSecs int64,
+	handle func(watch.EventType, *corev1.Namespace)) (string, error) {
+	opts := metav1.ListOptions{
+		ResourceVersion:     rv,
+		AllowWatchBookmarks: true,
+		TimeoutSeconds:      &timeoutSecs,
+		Watch:               true,
+	}
+
+	watcher, err := rc.Get().Resource("namespaces").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		// the client side timeout is a time.Duration: convert the seconds!
+		// (a bit longer than the server side one, that should fire first)
+		Timeout(time.Duration(timeoutSecs+10) * time.Second).
+		Watch(context.TODO())
+	if err != nil {
+		return rv, err
+	}
+
+	// keep only the events we are interested in, skipping duplicates
+	events := pipeline.New(watcher,
+		pipeline.EventTypes(watch.Added, watch.Modified, watch.Deleted, watch.Bookmark, watch.Error),
+		pipeline.Dedupe(),
+	)
+	defer events.Stop()
+
+	// iterate all the events
+	for event := range events.ResultChan() {
+		// errors carry a metav1.Status, not a Namespace
+		if event.Type == watch.Error {
+			return rv, errors.FromObject(event.Object)
+		}
+
+		// retrieve the Namespace
+		item, ok := event.Object.(*corev1.Namespace)
+		if !ok {
+			return rv, fmt.Errorf("unexpected object type '%T'", event.Object)
 		}
+
+		// remember where we are
+		rv = item.GetResourceVersion()
+
+		// bookmarks just move the resourceVersion forward
+		if event.Type == watch.Bookmark {
+			continue
+		}
+
+		handle(event.Type, item)
 	}
+
+	return rv, nil
+}
+
+// relistNamespaces lists the namespaces, calls handle for each difference
+// from the known ones and returns the resourceVersion to watch from
+func relistNamespaces(rc *rest.RESTClient, known *checkpoint.Checkpoint,
+	handle func(watch.EventType, *corev1.Namespace)) (string, error) {
+	list := corev1.NamespaceList{}
+	err := rc.Get().Resource("namespaces").
+		VersionedParams(&metav1.ListOptions{}, scheme.ParameterCodec).
+		Do(context.TODO()).
+		Into(&list)
+	if err != nil {
+		return "", err
+	}
+
+	current := map[string]string{}
+	byName := map[string]*corev1.Namespace{}
+	for i := range list.Items {
+		el := &list.Items[i]
+		current[el.Name] = el.GetResourceVersion()
+		byName[el.Name] = el
+	}
+
+	diff := known.Diff(current)
+	for _, name := range diff.Added {
+		handle(watch.Added, byName[name])
+	}
+	for _, name := range diff.Modified {
+		handle(watch.Modified, byName[name])
+	}
+	for _, name := range diff.Deleted {
+		// only the name is known: the namespace is gone (the
+		// tracker forgets it, since it tracks the objects by name)
+		handle(watch.Deleted, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		})
+	}
+
+	return list.GetResourceVersion(), nil
+}
+
+// label applies the policy to the added namespace and, unless it is a
+// dry run, records an Event about it; it returns the applied patch (nil
+// if the namespace was already compliant)
+func label(rc rest.Interface, rec record.EventRecorder, pol *policy.Policy,
+	po metav1.PatchOptions, item *corev1.Namespace) ([]byte, error) {
+	// what is missing according to the policy?
+	pd, err := pol.Patch(item)
+	if err != nil || pd == nil {
+		return nil, err
+	}
+
+	// try to patch it!
+	err = rc.Patch(types.MergePatchType).Resource("namespaces").
+		Name(item.Name).
+		VersionedParams(&po, scheme.ParameterCodec).
+		Body(pd).
+		Do(context.TODO()).
+		Error()
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing changed: nothing to tell
+	if len(po.DryRun) > 0 {
+		return pd, nil
+	}
+
+	// tell everyone what we did
+	rec.Eventf(item, corev1.EventTypeNormal, "Labeled",
+		"Policy applied by %s: %s", po.FieldManager, pd)
+
+	return pd, nil
 }
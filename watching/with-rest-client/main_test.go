@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+// patch is a request received by the fake API server
+type patch struct {
+	path, contentType, dryRun, fieldManager, body string
+}
+
+// newRESTClient returns a client of a fake API server answering
+// the namespace patches with an empty namespace
+func newRESTClient(t *testing.T) (*rest.RESTClient, *[]patch) {
+	t.Helper()
+
+	var patches []patch
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		patches = append(patches, patch{
+			path:         r.URL.Path,
+			contentType:  r.Header.Get("Content-Type"),
+			dryRun:       r.URL.Query().Get("dryRun"),
+			fieldManager: r.URL.Query().Get("fieldManager"),
+			body:         string(body),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	rc, err := rest.RESTClientFor(&rest.Config{
+		Host:    srv.URL,
+		APIPath: "/api",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion:         &corev1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rc, &patches
+}
+
+// events returns the events recorded so far
+func events(rec *record.FakeRecorder) []string {
+	var res []string
+	for {
+		select {
+		case el := <-rec.Events:
+			res = append(res, el)
+		default:
+			return res
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	rc, patches := newRESTClient(t)
+	rec := record.NewFakeRecorder(10)
+	po := metav1.PatchOptions{FieldManager: "my-cool-app"}
+
+	compliant := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "compliant", Labels: map[string]string{"modified-by": "lucasepe"},
+	}}
+	if pd, err := label(rc, rec, policy.Default(), po, compliant); err != nil || pd != nil {
+		t.Fatalf("got %s, %v, expected no patch", pd, err)
+	}
+
+	demo := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}}
+	pd, err := label(rc, rec, policy.Default(), po, demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := patch{
+		path:         "/api/v1/namespaces/demo",
+		contentType:  "application/merge-patch+json",
+		fieldManager: "my-cool-app",
+		body:         `{"metadata":{"labels":{"modified-by":"lucasepe"}}}`,
+	}
+	if len(*patches) != 1 || (*patches)[0] != expected {
+		t.Fatalf("got patches %+v, expected %+v", *patches, expected)
+	}
+
+	evts := events(rec)
+	if len(evts) != 1 || evts[0] != "Normal Labeled Policy applied by my-cool-app: "+string(pd) {
+		t.Fatalf("got events %q", evts)
+	}
+
+	// a dry run tells nothing
+	po.DryRun = []string{metav1.DryRunAll}
+	if _, err := label(rc, rec, policy.Default(), po, demo); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*patches)[1].dryRun; got != metav1.DryRunAll {
+		t.Fatalf("got dryRun=%q, expected %q", got, metav1.DryRunAll)
+	}
+	if evts := events(rec); len(evts) != 0 {
+		t.Fatalf("unexpected events %q", evts)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -9,136 +10,72 @@ import (
 
 	"k8s.io/klog/v2"
 
+	"github.com/lucasepe/using-client-go/pkg/admin"
+	"github.com/lucasepe/using-client-go/pkg/controller"
+	"github.com/lucasepe/using-client-go/pkg/deadletter"
+	"github.com/lucasepe/using-client-go/pkg/leader"
+	"github.com/lucasepe/using-client-go/pkg/metrics"
+	"github.com/lucasepe/using-client-go/pkg/recorder"
+	"github.com/lucasepe/using-client-go/pkg/signals"
+	"github.com/lucasepe/using-client-go/pkg/transform"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 )
 
-// Controller demonstrates how to implement a controller with client-go.
-type Controller struct {
-	queue    workqueue.RateLimitingInterface
-	informer cache.SharedInformer
+// PodReconciler demonstrates how to implement the business logic
+// of a controller: the queue, the retries and the workers are
+// handled by the controller package.
+type PodReconciler struct {
+	pods controller.Lister[*corev1.Pod]
 }
 
-// NewController creates a new Controller.
-func NewController(
-	queue workqueue.RateLimitingInterface,
-	informer cache.SharedInformer) *Controller {
-	return &Controller{
-		informer: informer,
-		queue:    queue,
-	}
-}
-
-func (c *Controller) processNextItem() bool {
-	// Wait until there is a new item in the working queue
-	key, quit := c.queue.Get()
-	if quit {
-		return false
-	}
-	// Tell the queue that we are done with processing this key.
-	// - unblocks the key for other workers
-	// - allows safe parallel processing because two pods with
-	//   the same key are never processed in parallel
-	defer c.queue.Done(key)
-
-	// Invoke the method containing the business logic
-	err := c.syncToStdout(key.(string))
-
-	// Handle the error if something went wrong during
-	// the execution of the business logic
-	c.handleErr(err, key)
-
-	return true
-}
-
-// syncToStdout is the business logic of the controller.
-// This controller simply prints information about the pod to stdout.
-// In case an error happened, it has to simply return the error.
-// The retry logic should not be part of the business logic.
-func (c *Controller) syncToStdout(key string) error {
-	obj, exists, err := c.informer.GetStore().GetByKey(key)
+// Reconcile simply prints information about the pod to stdout.
+// In case an error happened, it has to simply return the error:
+// the retry logic is not part of the business logic.
+func (r *PodReconciler) Reconcile(ctx context.Context, key controller.Key) (controller.Result, error) {
+	pod, exists, err := r.pods.Get(key)
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
-		return err
+		return controller.Result{}, err
 	}
 
 	if !exists {
 		fmt.Printf("Pod %s does not exist anymore\n", key)
-	} else {
-		fmt.Printf("Sync/Add/Update for Pod %s\n", obj.(*corev1.Pod).GetName())
-	}
-
-	return nil
-}
-
-// handleErr checks if an error happened and makes sure we will retry later.
-func (c *Controller) handleErr(err error, key interface{}) {
-	if err == nil {
-		// Forget about the #AddRateLimited history of the key
-		// on every successful synchronization.
-		// This ensures that future processing of updates for
-		// this key is not delayed because of an outdated error history.
-		c.queue.Forget(key)
-		return
-	}
-
-	// This controller retries 5 times if something goes wrong.
-	// After that, it stops trying.
-	if c.queue.NumRequeues(key) < 5 {
-		klog.Infof("Error syncing pod %v: %v", key, err)
-
-		// Re-enqueue the key rate limited. Based on the rate limiter on the
-		// queue and the re-enqueue history, the key will be processed later again.
-		c.queue.AddRateLimited(key)
-
-		return
-	}
-
-	c.queue.Forget(key)
-
-	// Report to an external entity that, even after
-	// several retries, we could not successfully process this key.
-	utilruntime.HandleError(err)
-
-	klog.Infof("Dropping pod %q out of the queue: %v", key, err)
-}
-
-// Run begins watching and syncing.
-func (c *Controller) Run(workers int, stopCh chan struct{}) {
-	// eventually catches a crash and logs an error
-	defer utilruntime.HandleCrash()
-
-	// Let the workers stop when we are done
-	defer c.queue.ShutDown()
-	klog.Info("Starting Pod controller")
-
-	go c.informer.Run(stopCh)
-
-	// Wait for all involved caches to be synced, before
-	// processing items from the queue is started
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
-		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
-		return
+		return controller.Result{}, nil
 	}
 
-	for i := 0; i < workers; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
-	}
+	// nothing is changed: no Event is recorded (there
+	// would be one for every pod at every resync)
+	fmt.Printf("Sync/Add/Update for Pod %s\n", pod.GetName())
 
-	<-stopCh
-	klog.Info("Stopping Pod controller")
+	return controller.Result{}, nil
 }
 
-func (c *Controller) runWorker() {
-	for c.processNextItem() {
+// deadLetter returns the controller.Options OnDrop hook recording the
+// dropped pods in the store and, if they still exist, a Warning Event
+func deadLetter(store *deadletter.Store, pods controller.Lister[*corev1.Pod], rec record.EventRecorder) func(context.Context, controller.Key, int, error) {
+	return func(ctx context.Context, key controller.Key, retries int, err error) {
+		if err := store.Add(ctx, deadletter.Entry{
+			Key:     key.String(),
+			Error:   err.Error(),
+			Retries: retries,
+		}); err != nil {
+			klog.ErrorS(err, "Saving the dead letters", "key", key)
+		}
+
+		// tell the pod owners, if the pod is still there
+		if pod, found, _ := pods.Get(key); found {
+			rec.Eventf(pod, corev1.EventTypeWarning, "Dropped",
+				"Pod dropped after %d retries: %v", retries, err)
+		}
 	}
 }
 
@@ -155,6 +92,23 @@ func main() {
 
 	resyncIn := flag.Duration("resync", 0*time.Second, "resync period for the shared informer")
 
+	maxRetries := flag.Int("max-retries", 5, "how many times a failing pod is retried before being dropped")
+
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "how long the pods being processed are given to complete on shutdown")
+
+	leaderElect := flag.Bool("leader-elect", false, "run the workers only in the replica holding the lease")
+	leaseNamespace := flag.String("lease-namespace", metav1.NamespaceDefault, "namespace of the leader election lease")
+	leaseName := flag.String("lease-name", "pod-controller", "name of the leader election lease")
+	leaseDuration := flag.Duration("lease-duration", 15*time.Second, "how long the standbys wait before taking over a lease not renewed")
+	renewDeadline := flag.Duration("renew-deadline", 10*time.Second, "how long the leader keeps trying to renew the lease before stepping down")
+	identity := flag.String("identity", leader.DefaultIdentity(), "identity of this replica in the leader election")
+
+	adminAddr := flag.String("admin-addr", "", "serve /healthz, /readyz, /metrics and /debug/pprof on this address (i.e. :8080)")
+
+	deadLetterConfigMap := flag.String("dead-letter-configmap", "", "persist the dropped pods in this ConfigMap (namespace/name), not only in memory")
+
+	transforms := flag.String("transform", "managed-fields,last-applied,pod-status", "trim the cached pods: managed-fields, last-applied, pod-status")
+
 	flag.Parse()
 
 	// build the config from the specified kubeconfig filepath
@@ -169,9 +123,6 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	// create the rate limiting work queue
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
-
 	// create a ListWatcher on PODs resources
 	listWatcher := &cache.ListWatch{
 		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
@@ -183,41 +134,139 @@ func main() {
 		},
 	}
 
+	// the pods are trimmed before being cached, to save memory
+	trim, err := transform.Parse(*transforms)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
 	// create the shared informer and resync every `resyncIn` user defined value
-	informer := cache.NewSharedInformer(listWatcher, &corev1.Pod{}, *resyncIn)
-
-	// add the event handlers - that just simply enqueue items
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			if err == nil {
-				queue.Add(key)
-			}
-		},
-		UpdateFunc: func(old interface{}, new interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(new)
-			if err == nil {
-				queue.Add(key)
+	informer := cache.NewSharedInformer(transform.ListWatch(listWatcher, trim), &corev1.Pod{}, *resyncIn)
+
+	// records the Events about the dropped pods
+	rec := recorder.New(clientset, scheme.Scheme, "pod-controller")
+
+	// the workqueue metrics must be registered before the queue is created
+	if len(*adminAddr) > 0 {
+		metrics.RegisterWorkqueue(prometheus.DefaultRegisterer)
+	}
+
+	// the pods dropped after `maxRetries` are kept in the dead-letter
+	// store, to be inspected and re-enqueued (see the admin server)
+	deadLetters := deadletter.NewStore()
+	if len(*deadLetterConfigMap) > 0 {
+		ns, name, err := cache.SplitMetaNamespaceKey(*deadLetterConfigMap)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		deadLetters, err = deadletter.NewPersistentStore(context.Background(),
+			deadletter.NewConfigMapPersister(clientset, ns, name))
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	pods := controller.NewLister[*corev1.Pod](informer)
+
+	// the controller retries the failing keys (rate limited) up to
+	// `maxRetries` times and, on shutdown, lets the keys being
+	// processed complete within `drainTimeout`
+	ctrl := controller.New(&PodReconciler{pods: pods}, controller.Options{
+		Name:         "pods",
+		MaxRetries:   *maxRetries,
+		DrainTimeout: *drainTimeout,
+		OnDrop:       deadLetter(deadLetters, pods, rec),
+	})
+
+	// the keys of the added, updated and deleted pods are enqueued
+	controller.Watch[*corev1.Pod](ctrl, informer)
+
+	// Now let's start the informer and the controller,
+	// until SIGINT (CTRL+C) or SIGTERM
+	ctx, cancel := signals.Context()
+	defer cancel()
+
+	// the informer runs in every replica: the standbys
+	// keep a warm cache, ready for when they take over
+	go informer.Run(ctx.Done())
+
+	// ready once the cache is synced (and the leader is known)
+	var srv *admin.Server
+	if len(*adminAddr) > 0 {
+		srv = admin.New(*adminAddr, prometheus.DefaultGatherer)
+		srv.AddReadyCheck("informers", admin.Synced(ctrl.HasSynced))
+
+		// lists (GET) and re-enqueues (POST ?key=<ns>/<name>) the dropped pods
+		srv.Handle("/deadletters", deadletter.Handler(deadLetters, func(key string) error {
+			k, err := controller.ParseKey(key)
+			if err != nil {
+				return err
 			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			// IndexerInformer uses a delta queue, therefore for
-			// deletes we have to use this key function.
-			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			if err == nil {
-				queue.Add(key)
+			ctrl.Enqueue(k)
+			return nil
+		}))
+
+		go func() {
+			if err := srv.Run(ctx); err != nil {
+				klog.Fatal(err)
 			}
-		},
-	})
+		}()
+	}
 
-	// create the controller
-	controller := NewController(queue, informer)
+	// returns once the queue has been drained
+	var runErr error
+	run := func(ctx context.Context) {
+		runErr = ctrl.Run(ctx, 1)
+	}
 
-	// Now let's start the controller
-	stop := make(chan struct{})
-	defer close(stop)
-	go controller.Run(1, stop)
+	if !*leaderElect {
+		run(ctx)
+	} else {
+		// when the leadership is lost, the drain has to complete before
+		// another replica can take over (shutting down, the lease is held)
+		if grace := *leaseDuration - *renewDeadline; *drainTimeout > grace {
+			klog.InfoS("The drain could be interrupted if the leadership is lost",
+				"drainTimeout", *drainTimeout, "leaseDuration-renewDeadline", grace)
+		}
+
+		// only the leader runs the workers
+		elector, err := leader.New(clientset, leader.Config{
+			Namespace:     *leaseNamespace,
+			Name:          *leaseName,
+			Identity:      *identity,
+			LeaseDuration: *leaseDuration,
+			RenewDeadline: *renewDeadline,
+		}, run)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		if srv != nil {
+			srv.AddReadyCheck("leader", elector.Ready)
+		}
+
+		klog.InfoS("Waiting for the leadership", "lease", *leaseName, "identity", *identity)
+
+		if err := elector.Run(ctx); err != nil {
+			// another replica could be leading already: exit at once
+			// and restart as a standby (with a fresh state)
+			klog.Fatal(err)
+		}
+	}
 
-	// Wait forever
-	select {}
+	rec.Flush(5 * time.Second)
+
+	// stopped before the caches were synced: a clean shutdown
+	if errors.Is(runErr, context.Canceled) {
+		runErr = nil
+	}
+
+	if errors.Is(runErr, controller.ErrDrainTimeout) {
+		klog.ErrorS(runErr, "Shutdown incomplete")
+		os.Exit(signals.ExitDrainTimeout)
+	}
+	if runErr != nil {
+		klog.Fatal(runErr)
+	}
 }
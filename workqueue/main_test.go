@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucasepe/using-client-go/pkg/controller"
+	"github.com/lucasepe/using-client-go/pkg/deadletter"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// podLister returns a Lister of the pods served by a fake clientset
+func podLister(t *testing.T, pods ...*corev1.Pod) controller.Lister[*corev1.Pod] {
+	t.Helper()
+
+	cs := fake.NewSimpleClientset()
+	for _, el := range pods {
+		if _, err := cs.CoreV1().Pods(el.Namespace).Create(context.TODO(), el, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	informer := factory.Core().V1().Pods().Informer()
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("failed to sync")
+	}
+
+	return controller.NewLister[*corev1.Pod](informer)
+}
+
+func TestDeadLetterRecordsWarning(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"}}
+
+	store := deadletter.NewStore()
+	rec := record.NewFakeRecorder(10)
+
+	onDrop := deadLetter(store, podLister(t, pod), rec)
+
+	onDrop(context.TODO(), controller.Key{Namespace: "default", Name: "nginx"}, 5, errors.New("boom"))
+
+	select {
+	case got := <-rec.Events:
+		if expected := "Warning Dropped Pod dropped after 5 retries: boom"; got != expected {
+			t.Fatalf("got event %q, expected %q", got, expected)
+		}
+	default:
+		t.Fatal("no event recorded")
+	}
+
+	// the pod does not exist anymore: no one to tell
+	onDrop(context.TODO(), controller.Key{Namespace: "default", Name: "gone"}, 5, errors.New("boom"))
+
+	select {
+	case got := <-rec.Events:
+		t.Fatalf("unexpected event %q", got)
+	default:
+	}
+
+	entries := store.List()
+	if len(entries) != 2 {
+		t.Fatalf("got %d dead letters, expected 2", len(entries))
+	}
+	if entries[0].Key != "default/nginx" || entries[0].Retries != 5 || entries[0].Error != "boom" {
+		t.Fatalf("unexpected dead letter %+v", entries[0])
+	}
+}